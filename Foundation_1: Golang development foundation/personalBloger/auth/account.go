@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"personalBloger/feed"
+	"personalBloger/mail"
+	"personalBloger/middleware"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"personalBloger/token"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// VerifyEmailTTL is how long an email verification link works
+	VerifyEmailTTL = 48 * time.Hour
+	// ResetPasswordTTL is how long a password reset token works
+	ResetPasswordTTL = time.Hour
+	// mailTimeout bounds the delivery of one account email
+	mailTimeout = time.Minute
+)
+
+type tokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=20"`
+}
+
+// issueAccountToken stores a new account token for the user's current address
+// and returns its plaintext
+func (ac *AuthController) issueAccountToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration) (string, error) {
+	plain := token.RandomString(32)
+	err := ac.store.AccountTokens().Save(ctx, &model.AccountToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: token.Hash(plain),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// siteURL is the public address of the API used in email links: SITE_URL when
+// it is set, otherwise the host the request was sent to
+func siteURL(c *gin.Context) string {
+	if base := feed.Current().BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// errNoSiteURL refuses email links to the request's host
+var errNoSiteURL = errors.New("feed.site_url is required to send links by email")
+
+// linkURL is the address email links start with. Only the log and file mailers,
+// which are meant for development, fall back to the request's host: a client
+// can send any Host header, and a real email would then carry the user's token
+// to the client's server.
+func linkURL(c *gin.Context) (string, error) {
+	if feed.Current().BaseURL == "" {
+		switch mail.Default().(type) {
+		case *mail.Log, *mail.File:
+		default:
+			return "", errNoSiteURL
+		}
+	}
+	return siteURL(c), nil
+}
+
+// deliver sends the message in the background, so the response does not wait
+// for the mail server and does not reveal whether an email was sent
+func deliver(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := mail.Default().Send(ctx, msg); err != nil {
+			middleware.GetLogger().WithError(err).WithField("subject", msg.Subject).Error("failed to send email")
+		}
+	}()
+}
+
+// sendVerificationEmail emails the user a link that verifies their address
+func (ac *AuthController) sendVerificationEmail(c *gin.Context, user *model.User) error {
+	plain, err := ac.issueAccountToken(c.Request.Context(), user, model.PurposeVerifyEmail, VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	base, err := linkURL(c)
+	if err != nil {
+		return err
+	}
+	link := base + "/v1/auth/verify_email?token=" + url.QueryEscape(plain)
+	deliver(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Open this link to verify your email address:\n\n" + link + "\n\n" +
+			"The link expires in " + strconv.Itoa(int(VerifyEmailTTL.Hours())) + " hours. If you did not sign up, ignore this email.\n",
+	})
+	return nil
+}
+
+// sendPasswordResetEmail emails the user a token that sets a new password
+func (ac *AuthController) sendPasswordResetEmail(ctx context.Context, user *model.User) error {
+	plain, err := ac.issueAccountToken(ctx, user, model.PurposeResetPassword, ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	deliver(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Someone asked to reset the password of your account. To choose a new password, send this token\n" +
+			"with it to POST /v1/auth/reset_password:\n\n" + plain + "\n\n" +
+			"The token expires in " + strconv.Itoa(int(ResetPasswordTTL.Minutes())) + " minutes. If you did not ask for it, ignore this email.\n",
+	})
+	return nil
+}
+
+// VerifyEmail marks the address the token was sent to as verified. It accepts
+// the token from the emailed link (GET ?token=) or as JSON (POST).
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	plain := c.Query("token")
+	if plain == "" {
+		var req tokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		plain = req.Token
+	}
+	ctx := c.Request.Context()
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		t, err := s.AccountTokens().Use(ctx, token.Hash(plain), model.PurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		return s.Users().MarkEmailVerified(ctx, t.UserID, t.Email)
+	})
+	if errors.Is(err, model.ErrInvalidAccountToken) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email address"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendVerification emails a new verification link. It answers the same way
+// whether or not the address belongs to an unverified account.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req emailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if user, err := ac.store.Users().FindByEmail(c.Request.Context(), req.Email); err == nil && !user.Verified() {
+		if err := ac.sendVerificationEmail(c, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an unverified account, a verification email has been sent"})
+}
+
+// ForgotPassword emails a password reset token. It answers the same way whether
+// or not the address belongs to an account.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req emailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if user, err := ac.store.Users().FindByEmail(c.Request.Context(), req.Email); err == nil {
+		if err := ac.sendPasswordResetEmail(c.Request.Context(), user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset email"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an account, a password reset email has been sent"})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and signs
+// the user out everywhere. Receiving the token also proves the address.
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		t, err := s.AccountTokens().Use(ctx, token.Hash(req.Token), model.PurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		user, err := s.Users().FindByID(ctx, t.UserID)
+		if err != nil {
+			return model.ErrInvalidAccountToken
+		}
+		if err := s.Users().SetPassword(ctx, user, req.Password); err != nil {
+			return err
+		}
+		if err := s.Users().MarkEmailVerified(ctx, user.ID, t.Email); err != nil {
+			return err
+		}
+		// The new password ends a lockout of the account
+		if err := s.LoginFailures().Clear(ctx, model.AccountLoginSubject(user.Username)); err != nil {
+			return err
+		}
+		return s.Sessions().RevokeAll(ctx, user.ID)
+	})
+	if errors.Is(err, model.ErrInvalidAccountToken) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"net/textproto"
+	"net/url"
+	"personalBloger/feed"
+	"personalBloger/mail"
+	"personalBloger/migrate"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openStore returns a store on a migrated database in a temporary directory
+func openStore(t *testing.T) (*gorm.DB, repository.Store) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db, repository.NewGormStore(db)
+}
+
+// sentMail is a message as a fake SMTP server received it
+type sentMail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// testSiteURL is the public address email links point to in the tests
+const testSiteURL = "https://blog.example.com"
+
+// startSMTP runs an SMTP server on a local port that accepts every message and
+// makes the mail package deliver to it, with links to testSiteURL
+func startSMTP(t *testing.T) <-chan sentMail {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	inbox := make(chan sentMail, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, inbox)
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	sender, err := mail.NewSMTP(mail.SMTPConfig{Host: "127.0.0.1", Port: port, From: "blog@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := mail.Default()
+	mail.SetDefault(sender)
+	t.Cleanup(func() { mail.SetDefault(previous) })
+	withSiteURL(t, testSiteURL)
+	return inbox
+}
+
+// serveSMTP speaks just enough SMTP for net/smtp: no STARTTLS, no AUTH
+func serveSMTP(conn net.Conn, inbox chan<- sentMail) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost fake SMTP")
+	var to string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg, err := netmail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+			if err != nil {
+				tp.PrintfLine("554 %s", err)
+				continue
+			}
+			body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+			subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			inbox <- sentMail{To: to, Subject: subject, Body: string(body)}
+			tp.PrintfLine("250 OK: queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// withSiteURL sets the public address for the test
+func withSiteURL(t *testing.T, base string) {
+	t.Helper()
+	previous := feed.Current()
+	settings := previous
+	settings.BaseURL = base
+	feed.Configure(settings)
+	t.Cleanup(func() { feed.Configure(previous) })
+}
+
+func receive(t *testing.T, inbox <-chan sentMail, subject string) sentMail {
+	t.Helper()
+	select {
+	case msg := <-inbox:
+		if msg.Subject != subject {
+			t.Fatalf("received %q, want %q", msg.Subject, subject)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %q email was sent", subject)
+	}
+	return sentMail{}
+}
+
+var (
+	verifyLinkPattern = regexp.MustCompile(`(\S+)/v1/auth/verify_email\?token=(\S+)`)
+	resetTokenPattern = regexp.MustCompile(`reset_password:\s+(\S+)`)
+)
+
+// find returns the last group of pattern in the email body
+func find(t *testing.T, msg sentMail, pattern *regexp.Regexp) string {
+	t.Helper()
+	match := pattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no %s in the email:\n%s", pattern, msg.Body)
+	}
+	return match[len(match)-1]
+}
+
+func accountRouter(ac *AuthController) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/signin", ac.SignIn)
+	r.POST("/login", ac.LogIn)
+	r.GET("/verify_email", ac.VerifyEmail)
+	r.POST("/forgot_password", ac.ForgotPassword)
+	r.POST("/reset_password", ac.ResetPassword)
+	return r
+}
+
+func call(r *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func verified(t *testing.T, db *gorm.DB, username string) bool {
+	t.Helper()
+	var user model.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Verified()
+}
+
+func TestSignUpAndVerifyEmail(t *testing.T) {
+	db, store := openStore(t)
+	inbox := startSMTP(t)
+	r := accountRouter(NewAuthController(store))
+
+	w := call(r, "POST", "/signin", `{"username":"alice","password":"password123","email":"alice@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sign up: status %d, body %s", w.Code, w.Body)
+	}
+	msg := receive(t, inbox, "Verify your email address")
+	if msg.To != "alice@example.com" {
+		t.Errorf("verification email sent to %q", msg.To)
+	}
+	if base := verifyLinkPattern.FindStringSubmatch(msg.Body); base == nil || base[1] != testSiteURL {
+		t.Errorf("verification link does not start with %s:\n%s", testSiteURL, msg.Body)
+	}
+	if verified(t, db, "alice") {
+		t.Fatal("alice is verified before opening the link")
+	}
+
+	plain, err := url.QueryUnescape(find(t, msg, verifyLinkPattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "/verify_email?token=" + url.QueryEscape(plain)
+	if w := call(r, "GET", link, ""); w.Code != http.StatusOK {
+		t.Fatalf("verify: status %d, body %s", w.Code, w.Body)
+	}
+	if !verified(t, db, "alice") {
+		t.Error("alice is not verified after opening the link")
+	}
+	if w := call(r, "GET", link, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("verify with a used token: status %d, want 400", w.Code)
+	}
+}
+
+func TestVerificationLinkExpires(t *testing.T) {
+	db, store := openStore(t)
+	inbox := startSMTP(t)
+	r := accountRouter(NewAuthController(store))
+
+	call(r, "POST", "/signin", `{"username":"bob","password":"password123","email":"bob@example.com"}`)
+	plain, _ := url.QueryUnescape(find(t, receive(t, inbox, "Verify your email address"), verifyLinkPattern))
+	db.Exec("UPDATE account_tokens SET expires_at = ?", time.Now().Add(-time.Minute))
+
+	if w := call(r, "GET", "/verify_email?token="+url.QueryEscape(plain), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("verify with an expired token: status %d, want 400", w.Code)
+	}
+	if verified(t, db, "bob") {
+		t.Error("an expired link verified bob")
+	}
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	db, store := openStore(t)
+	inbox := startSMTP(t)
+	r := accountRouter(NewAuthController(store))
+
+	call(r, "POST", "/signin", `{"username":"carol","password":"password123","email":"carol@example.com"}`)
+	verifyToken, _ := url.QueryUnescape(find(t, receive(t, inbox, "Verify your email address"), verifyLinkPattern))
+
+	// Unknown addresses get the same answer and no email
+	if w := call(r, "POST", "/forgot_password", `{"email":"nobody@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("forgot for an unknown address: status %d", w.Code)
+	}
+	if w := call(r, "POST", "/forgot_password", `{"email":"carol@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("forgot: status %d, body %s", w.Code, w.Body)
+	}
+	msg := receive(t, inbox, "Reset your password")
+	if msg.To != "carol@example.com" {
+		t.Errorf("reset email sent to %q", msg.To)
+	}
+	resetToken := find(t, msg, resetTokenPattern)
+
+	// A verification token cannot reset the password
+	body := `{"token":"` + verifyToken + `","password":"newpassword1"}`
+	if w := call(r, "POST", "/reset_password", body); w.Code != http.StatusBadRequest {
+		t.Errorf("reset with a verification token: status %d, want 400", w.Code)
+	}
+	body = `{"token":"` + resetToken + `","password":"newpassword1"}`
+	if w := call(r, "POST", "/reset_password", body); w.Code != http.StatusOK {
+		t.Fatalf("reset: status %d, body %s", w.Code, w.Body)
+	}
+	if !verified(t, db, "carol") {
+		t.Error("a reset through the emailed token does not verify the address")
+	}
+	if w := call(r, "POST", "/login", `{"username":"carol","password":"newpassword1"}`); w.Code != http.StatusOK {
+		t.Errorf("log in with the new password: status %d, body %s", w.Code, w.Body)
+	}
+	if w := call(r, "POST", "/login", `{"username":"carol","password":"password123"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("log in with the old password: status %d, want 401", w.Code)
+	}
+
+	body = `{"token":"` + resetToken + `","password":"another123"}`
+	if w := call(r, "POST", "/reset_password", body); w.Code != http.StatusBadRequest {
+		t.Errorf("reset with a used token: status %d, want 400", w.Code)
+	}
+
+	// A new token is refused once it expires
+	call(r, "POST", "/forgot_password", `{"email":"carol@example.com"}`)
+	expired := find(t, receive(t, inbox, "Reset your password"), resetTokenPattern)
+	db.Exec("UPDATE account_tokens SET expires_at = ? WHERE used_at IS NULL", time.Now().Add(-time.Second))
+	body = `{"token":"` + expired + `","password":"another123"}`
+	if w := call(r, "POST", "/reset_password", body); w.Code != http.StatusBadRequest {
+		t.Errorf("reset with an expired token: status %d, want 400", w.Code)
+	}
+}
+
+func TestEmailLinksIgnoreHostHeader(t *testing.T) {
+	_, store := openStore(t)
+	inbox := startSMTP(t)
+	withSiteURL(t, "")
+	r := accountRouter(NewAuthController(store))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/signin", strings.NewReader(`{"username":"dave","password":"password123","email":"dave@example.com"}`))
+	req.Host = "attacker.example"
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sign up: status %d, body %s", w.Code, w.Body)
+	}
+	select {
+	case msg := <-inbox:
+		t.Errorf("an email with a link to the request's host was sent:\n%s", msg.Body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -3,14 +3,20 @@ package auth
 import (
 	"net/http"
 	"personalBloger/model"
-	"time"
+	"personalBloger/repository"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type AuthController struct{}
+type AuthController struct {
+	store repository.Store
+}
+
+// NewAuthController returns an AuthController that works on store
+func NewAuthController(store repository.Store) *AuthController {
+	return &AuthController{store: store}
+}
 
 type AuthResponse struct {
 	Code    int         `json:"code"`
@@ -43,13 +49,12 @@ func (ac *AuthController) SignIn(c *gin.Context) {
 	//Check
 	//Check if Username or email exist
 	//
-	var existingUser model.User
-	if err := model.DB.Where("username=?", req.Username).First(&existingUser).Error; err == nil {
+	ctx := c.Request.Context()
+	if _, err := ac.store.Users().FindByUsername(ctx, req.Username); err == nil {
 		c.JSON(400, gin.H{"error": "Username already exists"})
 		return
 	}
-	var existingEmail model.User
-	if err := model.DB.Where("username=?", req.Username).First(&existingEmail).Error; err == nil {
+	if _, err := ac.store.Users().FindByEmail(ctx, req.Email); err == nil {
 		c.JSON(400, gin.H{"error": "Email already exists"})
 		return
 	}
@@ -59,10 +64,14 @@ func (ac *AuthController) SignIn(c *gin.Context) {
 		Email:    req.Email,
 		Password: req.Password,
 	}
-	if err := model.DB.Create(&user).Error; err != nil {
+	if err := ac.store.Users().Create(ctx, &user); err != nil {
 		c.JSON(400, gin.H{"error": "Failed to create a user"})
 		return
 	}
+	// The account exists either way; a lost email can be sent again
+	if err := ac.sendVerificationEmail(c, &user); err != nil {
+		c.Error(err)
+	}
 	c.JSON(200, gin.H{"success": "Sign in successful"})
 }
 
@@ -72,37 +81,42 @@ func (ac *AuthController) LogIn(c *gin.Context) {
 	var req logInRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	// refuse to check passwords while the account or the client is locked out;
+	// otherwise the attempt counts as a failure until the password checks out
+	attempt, ok := ac.reserveLoginAttempt(c, req.Username)
+	if !ok {
+		return
 	}
 	// check if user exist, return error if user doesn't exist
-	var existingUser model.User
-	if err := model.DB.Where("username=?", req.Username).First(&existingUser).Error; err != nil {
+	existingUser, err := ac.store.Users().FindByUsername(c.Request.Context(), req.Username)
+	if err != nil {
+		ac.loginFailed(c, req.Username, attempt)
 		c.JSON(400, gin.H{"error": "Invalid username or password"})
 		return
 	}
 	// check if password match, return error if password doesn't match
 	// var storedUser model.User
 	if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(req.Password)); err != nil {
+		ac.loginFailed(c, req.Username, attempt)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
-	//JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":       existingUser.ID,
-		"username": existingUser.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte("your_secret_key"))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	ac.releaseLoginAttempt(c, attempt)
+	if !existingUser.Verified() && model.CurrentUnverifiedPolicy() == model.UnverifiedBlock {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
 		return
 	}
-	c.JSON(http.StatusOK, AuthResponse{
-		Code:    200,
-		Message: "success",
-		Data: gin.H{
-			"Token": tokenString,
-			"User":  existingUser,
-		},
-	})
+	// with two-factor authentication the password only earns a challenge, and
+	// failures are only cleared once the second factor checks out
+	if ac.challengeSecondFactor(c, existingUser) {
+		return
+	}
+	// a correct password clears the account's failures, not those of the IP
+	if err := ac.store.LoginFailures().Clear(c.Request.Context(), model.AccountLoginSubject(existingUser.Username)); err != nil {
+		c.Error(err)
+	}
+	//JWT
+	ac.respondWithSession(c, existingUser)
 }
@@ -0,0 +1,14 @@
+package auth
+
+import (
+	"net/http"
+	"personalBloger/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public signing keys so other services can verify blog tokens
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, token.Keys().JWKS())
+}
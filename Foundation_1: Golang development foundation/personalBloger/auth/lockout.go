@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"personalBloger/middleware"
+	"personalBloger/model"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// LockoutPolicy slows down password guessing. After FreeFailures failed logins
+// every further attempt has to wait, twice as long each time from BaseDelay up
+// to MaxDelay. Reaching MaxFailures for an account, or IPMaxFailures from one
+// client IP, locks it out for Duration. Failures older than Duration are forgotten.
+type LockoutPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	Duration      time.Duration
+	FreeFailures  int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxFailures:   5,
+	IPMaxFailures: 20,
+	Duration:      15 * time.Minute,
+	FreeFailures:  2,
+	BaseDelay:     time.Second,
+	MaxDelay:      30 * time.Second,
+}
+
+var lockoutPolicy = DefaultLockoutPolicy
+
+// SetLockoutPolicy replaces the policy used by LogIn
+func SetLockoutPolicy(p LockoutPolicy) {
+	lockoutPolicy = p
+}
+
+// delay is how long to wait after the count-th failure
+func (p LockoutPolicy) delay(count int) time.Duration {
+	if count <= p.FreeFailures {
+		return 0
+	}
+	d := float64(p.BaseDelay) * math.Pow(2, float64(count-p.FreeFailures-1))
+	return time.Duration(math.Min(d, float64(p.MaxDelay)))
+}
+
+// wait is how long the subject of f has to wait before the next attempt
+func (p LockoutPolicy) wait(f model.LoginFailure, now time.Time) time.Duration {
+	wait := f.LastFailedAt.Add(p.delay(f.Count)).Sub(now)
+	if f.LockedUntil != nil {
+		if locked := f.LockedUntil.Sub(now); locked > wait {
+			wait = locked
+		}
+	}
+	return wait
+}
+
+// securityLog returns a log entry for a login event
+func securityLog(c *gin.Context, event, username string) *logrus.Entry {
+	return middleware.GetLogger().WithFields(logrus.Fields{
+		"event":     event,
+		"username":  username,
+		"client_ip": c.ClientIP(),
+	})
+}
+
+// errLoginThrottled stops a reservation while a subject has to wait
+var errLoginThrottled = errors.New("login throttled")
+
+// loginAttempt is a login attempt that was counted as a failure before the
+// credentials were checked, so that concurrent attempts cannot get past the
+// lockout between the check and the count
+type loginAttempt struct {
+	subjects []string
+	// maxFailures holds the lockout threshold of each subject
+	maxFailures []int
+	// previous and counted are the failure records before and after counting
+	previous []model.LoginFailure
+	counted  []model.LoginFailure
+}
+
+// count records a failure at now on f, forgetting failures older than Duration
+// first, and locks the subject out when it reaches maxFailures
+func (p LockoutPolicy) count(f *model.LoginFailure, maxFailures int, now time.Time) {
+	if now.Sub(f.LastFailedAt) > p.Duration && (f.LockedUntil == nil || now.After(*f.LockedUntil)) {
+		f.Count = 0
+		f.LockedUntil = nil
+	}
+	f.Count++
+	f.LastFailedAt = now
+	if f.Count >= maxFailures {
+		until := now.Add(p.Duration)
+		f.LockedUntil = &until
+	}
+}
+
+// reserveLoginAttempt counts the attempt as a failed login for the username and
+// the client IP before the credentials are checked; releaseLoginAttempt takes
+// it back if they are right. While the username or the IP has to wait it
+// responds with 429 instead, without counting anything.
+func (ac *AuthController) reserveLoginAttempt(c *gin.Context, username string) (*loginAttempt, bool) {
+	attempt := &loginAttempt{
+		subjects:    []string{model.AccountLoginSubject(username), model.IPLoginSubject(c.ClientIP())},
+		maxFailures: []int{lockoutPolicy.MaxFailures, lockoutPolicy.IPMaxFailures},
+	}
+	now := time.Now()
+	var wait time.Duration
+	counted, err := ac.store.LoginFailures().Update(c.Request.Context(), attempt.subjects, func(failures []model.LoginFailure) error {
+		for _, f := range failures {
+			if w := lockoutPolicy.wait(f, now); w > wait {
+				wait = w
+			}
+		}
+		if wait > 0 {
+			return errLoginThrottled
+		}
+		attempt.previous = slices.Clone(failures)
+		for i := range failures {
+			lockoutPolicy.count(&failures[i], attempt.maxFailures[i], now)
+		}
+		return nil
+	})
+	if errors.Is(err, errLoginThrottled) {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		securityLog(c, "login_throttled", username).WithField("retry_after_s", retryAfter).Warn("login attempt rejected")
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return nil, false
+	}
+	attempt.counted = counted
+	return attempt, true
+}
+
+// loginFailed logs a reserved attempt whose credentials were wrong, and the
+// lockouts it caused
+func (ac *AuthController) loginFailed(c *gin.Context, username string, attempt *loginAttempt) {
+	securityLog(c, "login_failed", username).Warn("failed login")
+	for i, failure := range attempt.counted {
+		if failure.Count == attempt.maxFailures[i] {
+			securityLog(c, "login_locked", username).
+				WithFields(logrus.Fields{"subject": failure.Subject, "locked_until": failure.LockedUntil}).
+				Warn("locked out after too many failed logins")
+		}
+	}
+}
+
+// releaseLoginAttempt takes back a reserved attempt whose credentials were
+// right. Failures counted since the reservation stay counted.
+func (ac *AuthController) releaseLoginAttempt(c *gin.Context, attempt *loginAttempt) {
+	_, err := ac.store.LoginFailures().Update(c.Request.Context(), attempt.subjects, func(failures []model.LoginFailure) error {
+		for i := range failures {
+			f, counted := &failures[i], attempt.counted[i]
+			switch {
+			case f.Count == counted.Count && f.LastFailedAt.Equal(counted.LastFailedAt):
+				// Nothing happened since, so the record goes back to how it was
+				*f = attempt.previous[i]
+			case f.Count > 0:
+				f.Count--
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"personalBloger/middleware"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"personalBloger/token"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// oidcCookie carries the state, nonce and PKCE verifier from the redirect
+	// to the provider until the callback
+	oidcCookie = "oidc_login"
+	// oidcLoginTTL is how long the user has to sign in at the provider
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// OIDCConfig describes the OpenID Connect provider. The provider's endpoints
+// and keys are discovered from Issuer. RedirectURL defaults to the callback
+// route on the host the login started from.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// oidcProvider discovers the provider on first use and keeps it once that works,
+// so the server starts even while the provider is unreachable
+type oidcProvider struct {
+	cfg OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+var oidcLogin *oidcProvider
+
+// ConfigureOIDC enables login through the provider
+func ConfigureOIDC(cfg OIDCConfig) {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	oidcLogin = &oidcProvider{cfg: cfg}
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+// oauth2Config returns the client configuration for a login started by c
+func (p *oidcProvider) oauth2Config(c *gin.Context, provider *oidc.Provider) *oauth2.Config {
+	redirectURL := p.cfg.RedirectURL
+	if redirectURL == "" {
+		redirectURL = siteURL(c) + "/v1/auth/oidc/callback"
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       p.cfg.Scopes,
+	}
+}
+
+// oidcState is stored in the oidcCookie while the user is at the provider
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// oidcClaims are the ID token claims used to find or create the user
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+// oidcProviderOrAbort returns the discovered provider, responding with an error
+// if OIDC is not configured or the provider cannot be reached
+func oidcProviderOrAbort(c *gin.Context) (*oidc.Provider, bool) {
+	if oidcLogin == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OpenID Connect login is not configured"})
+		return nil, false
+	}
+	provider, err := oidcLogin.discover(c.Request.Context())
+	if err != nil {
+		middleware.GetLogger().WithError(err).Error("failed to discover the OpenID Connect provider")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The identity provider is not available"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// OIDCLogin redirects to the provider. The state, nonce and PKCE verifier are
+// kept in a short-lived HttpOnly cookie for the callback.
+func (ac *AuthController) OIDCLogin(c *gin.Context) {
+	provider, ok := oidcProviderOrAbort(c)
+	if !ok {
+		return
+	}
+	state := oidcState{
+		State:    token.RandomString(16),
+		Nonce:    token.RandomString(16),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	value, _ := json.Marshal(state)
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, base64.RawURLEncoding.EncodeToString(value), int(oidcLoginTTL.Seconds()), "/v1/auth/oidc", "", secure, true)
+
+	url := oidcLogin.oauth2Config(c, provider).AuthCodeURL(state.State,
+		oidc.Nonce(state.Nonce),
+		oauth2.S256ChallengeOption(state.Verifier))
+	c.Redirect(http.StatusFound, url)
+}
+
+// OIDCCallback finishes the login: it exchanges the code, verifies the ID
+// token, finds or creates the linked user and returns the same tokens as LogIn.
+// Users with two-factor authentication get a challenge instead, as with a
+// password; the provider's own MFA does not replace it.
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	provider, ok := oidcProviderOrAbort(c)
+	if !ok {
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The identity provider refused the login: " + errParam})
+		return
+	}
+	state, ok := readOIDCState(c)
+	c.SetCookie(oidcCookie, "", -1, "/v1/auth/oidc", "", false, true)
+	if !ok || c.Query("state") != state.State {
+		c.JSON(400, gin.H{"error": "Invalid or expired login, please start again"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	oauth2Token, err := oidcLogin.oauth2Config(c, provider).Exchange(ctx, c.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		middleware.GetLogger().WithError(err).Warn("failed to exchange the OpenID Connect code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to log in with the identity provider"})
+		return
+	}
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The identity provider returned no ID token"})
+		return
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oidcLogin.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		middleware.GetLogger().WithError(err).Warn("invalid OpenID Connect ID token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil || claims.Nonce != state.Nonce {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	user, err := ac.linkExternalUser(c.Request.Context(), idToken.Issuer, idToken.Subject, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if !user.Verified() && model.CurrentUnverifiedPolicy() == model.UnverifiedBlock {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
+		return
+	}
+	if ac.challengeSecondFactor(c, user) {
+		return
+	}
+	ac.respondWithSession(c, user)
+}
+
+// readOIDCState decodes the oidcCookie
+func readOIDCState(c *gin.Context) (oidcState, bool) {
+	var state oidcState
+	value, err := c.Cookie(oidcCookie)
+	if err != nil {
+		return state, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &state) != nil || state.State == "" {
+		return state, false
+	}
+	return state, true
+}
+
+// linkExternalUser returns the user linked to the provider account, linking or
+// creating one on the first login. An existing user is only linked by email
+// address when both the provider and the blog have verified that address.
+func (ac *AuthController) linkExternalUser(ctx context.Context, issuer, subject string, claims oidcClaims) (*model.User, error) {
+	var user *model.User
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		identity, err := s.Identities().Find(ctx, issuer, subject)
+		if err == nil {
+			if err := s.Identities().UpdateEmail(ctx, identity, claims.Email); err != nil {
+				return err
+			}
+			user, err = s.Users().FindByID(ctx, identity.UserID)
+			return err
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if claims.Email != "" && claims.EmailVerified {
+			found, err := s.Users().FindByEmail(ctx, claims.Email)
+			if err == nil && found.Verified() {
+				user = found
+			} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		if user == nil {
+			if user, err = createExternalUser(ctx, s.Users(), claims); err != nil {
+				return err
+			}
+		}
+		return s.Identities().Create(ctx, &model.ExternalIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: subject,
+			Email:   claims.Email,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createExternalUser creates a user for a provider account. The random password
+// is longer than LogIn accepts, so the user can only set one by resetting it.
+func createExternalUser(ctx context.Context, users repository.UserRepository, claims oidcClaims) (*model.User, error) {
+	suggested := claims.PreferredUsername
+	if suggested == "" {
+		suggested, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username, err := users.AvailableUsername(ctx, suggested)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username: username,
+		Email:    claims.Email,
+		Password: token.RandomString(32),
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testClientID     = "blog"
+	testClientSecret = "client-secret"
+)
+
+// mockIssuer is an OpenID Connect provider with discovery, a JWKS, an
+// authorization endpoint that logs the configured account in without asking,
+// and a token endpoint that checks the PKCE verifier
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// The account the provider logs in
+	subject, email, username string
+	emailVerified            bool
+	// nonce and audience, when set, replace the right values in ID tokens
+	nonce, audience string
+
+	mu     sync.Mutex
+	logins map[string]mockLogin
+}
+
+// mockLogin is an authorization code waiting to be exchanged
+type mockLogin struct {
+	challenge, nonce string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, logins: map[string]mockLogin{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	ConfigureOIDC(OIDCConfig{Issuer: m.server.URL, ClientID: testClientID, ClientSecret: testClientSecret})
+	t.Cleanup(func() { oidcLogin = nil })
+	return m
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := randomCode()
+	m.mu.Lock()
+	m.logins[code] = mockLogin{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testClientID || secret != testClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+	// Codes work once
+	m.mu.Lock()
+	login, ok := m.logins[r.PostForm.Get("code")]
+	delete(m.logins, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != login.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	nonce, audience := login.nonce, testClientID
+	if m.nonce != "" {
+		nonce = m.nonce
+	}
+	if m.audience != "" {
+		audience = m.audience
+	}
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": randomCode(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token": m.sign(map[string]interface{}{
+			"iss":                m.server.URL,
+			"sub":                m.subject,
+			"aud":                audience,
+			"iat":                now.Unix(),
+			"exp":                now.Add(5 * time.Minute).Unix(),
+			"nonce":              nonce,
+			"email":              m.email,
+			"email_verified":     m.emailVerified,
+			"preferred_username": m.username,
+		}),
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// sign returns the claims as an RS256 JWT
+func (m *mockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func randomCode() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func oidcRouter(ac *AuthController) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/auth/oidc/login", ac.OIDCLogin)
+	r.GET("/v1/auth/oidc/callback", ac.OIDCCallback)
+	return r
+}
+
+// loginThroughIssuer starts a login, lets the provider authorize it and calls
+// the callback. tamper may change the callback's query and the login cookie
+// before that.
+func loginThroughIssuer(t *testing.T, r *gin.Engine, tamper func(query url.Values, state *oidcState)) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d, body %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login cookies = %v, want one HttpOnly %s cookie", cookies, oidcCookie)
+	}
+
+	// The provider sends the browser back to the callback
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	query := callback.Query()
+	cookie := cookies[0]
+	if tamper != nil {
+		raw, _ := base64.RawURLEncoding.DecodeString(cookie.Value)
+		var state oidcState
+		json.Unmarshal(raw, &state)
+		tamper(query, &state)
+		raw, _ = json.Marshal(state)
+		cookie.Value = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	req := httptest.NewRequest("GET", "/v1/auth/oidc/callback?"+query.Encode(), nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// loggedInUser returns the id of the user a successful callback logged in
+func loggedInUser(t *testing.T, w *httptest.ResponseRecorder) uint {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: status %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Token string
+			User  model.User
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.Token == "" {
+		t.Fatalf("callback returned no token: %s", w.Body)
+	}
+	return resp.Data.User.ID
+}
+
+func createUser(t *testing.T, db *gorm.DB, store repository.Store, username, email string, verified bool) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Email: email, Password: "password123"}
+	if err := store.Users().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		db.Model(user).Update("email_verified_at", time.Now())
+	}
+	return user
+}
+
+func TestOIDCLoginCreatesAndKeepsLink(t *testing.T) {
+	db, store := openStore(t)
+	issuer := newMockIssuer(t)
+	issuer.subject, issuer.email, issuer.username, issuer.emailVerified = "sub-1", "dora@example.com", "dora", true
+	r := oidcRouter(NewAuthController(store))
+
+	id := loggedInUser(t, loginThroughIssuer(t, r, nil))
+	var user model.User
+	db.First(&user, id)
+	if user.Username != "dora" || user.Email != "dora@example.com" || !user.Verified() {
+		t.Errorf("created user = %+v, want the verified dora@example.com", user)
+	}
+
+	// The link follows the subject, not the address
+	issuer.email = "dora@new.example.com"
+	if again := loggedInUser(t, loginThroughIssuer(t, r, nil)); again != id {
+		t.Errorf("second login logged in user %d, want %d", again, id)
+	}
+	var identity model.ExternalIdentity
+	db.Where("subject = ?", "sub-1").First(&identity)
+	if identity.UserID != id || identity.Email != "dora@new.example.com" {
+		t.Errorf("identity = %+v, want user %d with the new address", identity, id)
+	}
+	var users int64
+	db.Model(&model.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("%d users after two logins, want 1", users)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedEmails(t *testing.T) {
+	tests := []struct {
+		name             string
+		localVerified    bool
+		providerVerified bool
+		wantLinked       bool
+	}{
+		{"both verified", true, true, true},
+		{"blog address unverified", false, true, false},
+		{"provider address unverified", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, store := openStore(t)
+			local := createUser(t, db, store, "erin", "erin@example.com", tt.localVerified)
+			issuer := newMockIssuer(t)
+			issuer.subject, issuer.email, issuer.username, issuer.emailVerified = "sub-erin", "erin@example.com", "erin", tt.providerVerified
+			r := oidcRouter(NewAuthController(store))
+
+			id := loggedInUser(t, loginThroughIssuer(t, r, nil))
+			if linked := id == local.ID; linked != tt.wantLinked {
+				t.Errorf("linked to the existing user = %v, want %v", linked, tt.wantLinked)
+			}
+			if !tt.wantLinked {
+				var created model.User
+				db.First(&created, id)
+				if created.Username == "erin" {
+					t.Error("the new user took the existing username")
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(query url.Values, state *oidcState)
+		issuer   func(m *mockIssuer)
+		wantCode int
+	}{
+		{
+			name:     "state from another login",
+			tamper:   func(query url.Values, state *oidcState) { query.Set("state", "forged") },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "cookie without state",
+			tamper:   func(query url.Values, state *oidcState) { *state = oidcState{} },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "wrong PKCE verifier",
+			tamper:   func(query url.Values, state *oidcState) { state.Verifier = strings.Repeat("x", 43) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "nonce of another login",
+			issuer:   func(m *mockIssuer) { m.nonce = "replayed" },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "ID token for another client",
+			issuer:   func(m *mockIssuer) { m.audience = "other" },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "provider error",
+			tamper:   func(query url.Values, state *oidcState) { query.Set("error", "access_denied") },
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, store := openStore(t)
+			issuer := newMockIssuer(t)
+			issuer.subject, issuer.email, issuer.username, issuer.emailVerified = "sub-2", "finn@example.com", "finn", true
+			if tt.issuer != nil {
+				tt.issuer(issuer)
+			}
+			r := oidcRouter(NewAuthController(store))
+
+			w := loginThroughIssuer(t, r, tt.tamper)
+			if w.Code != tt.wantCode {
+				t.Errorf("callback: status %d, want %d, body %s", w.Code, tt.wantCode, w.Body)
+			}
+			var users int64
+			db.Model(&model.User{}).Count(&users)
+			if users != 0 {
+				t.Errorf("a rejected login created %d users", users)
+			}
+		})
+	}
+}
+
+func TestOIDCCodeWorksOnce(t *testing.T) {
+	_, store := openStore(t)
+	issuer := newMockIssuer(t)
+	issuer.subject, issuer.email, issuer.emailVerified = "sub-3", "gus@example.com", true
+	r := oidcRouter(NewAuthController(store))
+
+	var replay *http.Request
+	loggedInUser(t, loginThroughIssuer(t, r, func(query url.Values, state *oidcState) {
+		raw, _ := json.Marshal(state)
+		replay = httptest.NewRequest("GET", "/v1/auth/oidc/callback?"+query.Encode(), nil)
+		replay.AddCookie(&http.Cookie{Name: oidcCookie, Value: base64.RawURLEncoding.EncodeToString(raw)})
+	}))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, replay)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed callback: status %d, want 401", w.Code)
+	}
+}
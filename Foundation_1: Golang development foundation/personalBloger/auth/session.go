@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"personalBloger/token"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type logOutRequest struct {
+	All bool `json:"all"`
+}
+
+// tokenPair is returned by every endpoint that signs a user in
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// issueRefreshToken stores a new refresh token for the session and returns its plaintext
+func issueRefreshToken(ctx context.Context, sessions repository.SessionRepository, session *model.Session) (string, error) {
+	plain := token.RandomString(32)
+	refresh := model.RefreshToken{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		TokenHash: token.Hash(plain),
+		ExpiresAt: time.Now().Add(token.RefreshTokenTTL),
+	}
+	if err := sessions.CreateRefreshToken(ctx, &refresh); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// startSession opens a new session for the user and returns its first token pair
+func (ac *AuthController) startSession(ctx context.Context, user *model.User) (*tokenPair, error) {
+	session := model.Session{
+		ID:        token.RandomString(16),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(token.RefreshTokenTTL),
+	}
+	var pair tokenPair
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		if err := s.Sessions().Create(ctx, &session); err != nil {
+			return err
+		}
+		refresh, err := issueRefreshToken(ctx, s.Sessions(), &session)
+		if err != nil {
+			return err
+		}
+		access, err := token.GenerateAccessToken(user, session.ID)
+		if err != nil {
+			return err
+		}
+		pair = tokenPair{AccessToken: access, RefreshToken: refresh}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// respondWithSession starts a session for the user and responds with its tokens
+func (ac *AuthController) respondWithSession(c *gin.Context, user *model.User) {
+	pair, err := ac.startSession(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, AuthResponse{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"Token":        pair.AccessToken,
+			"RefreshToken": pair.RefreshToken,
+			"ExpiresIn":    int(token.AccessTokenTTL.Seconds()),
+			"User":         user,
+		},
+	})
+}
+
+// rotateRefreshToken consumes a refresh token and issues a new pair for the same session.
+// Presenting a token that was already used revokes the whole session, since it
+// means the token has been copied.
+func (ac *AuthController) rotateRefreshToken(ctx context.Context, plain string) (*tokenPair, error) {
+	var pair tokenPair
+	var reused bool
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		refresh, err := s.Sessions().FindRefreshToken(ctx, token.Hash(plain))
+		if err != nil {
+			return errInvalidRefreshToken
+		}
+		session, err := s.Sessions().FindByID(ctx, refresh.SessionID)
+		if err != nil {
+			return errInvalidRefreshToken
+		}
+		if !session.IsActive() || time.Now().After(refresh.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+		if refresh.UsedAt != nil {
+			reused = true
+			return s.Sessions().Revoke(ctx, session.UserID, session.ID)
+		}
+		// Mark the token as used only if nobody else consumed it concurrently
+		used, err := s.Sessions().UseRefreshToken(ctx, refresh)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidRefreshToken
+		}
+
+		user, err := s.Users().FindByID(ctx, session.UserID)
+		if err != nil {
+			return errInvalidRefreshToken
+		}
+		newRefresh, err := issueRefreshToken(ctx, s.Sessions(), session)
+		if err != nil {
+			return err
+		}
+		access, err := token.GenerateAccessToken(user, session.ID)
+		if err != nil {
+			return err
+		}
+		pair = tokenPair{AccessToken: access, RefreshToken: newRefresh}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, errInvalidRefreshToken
+	}
+	return &pair, nil
+}
+
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	pair, err := ac.rotateRefreshToken(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, errInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	c.JSON(http.StatusOK, AuthResponse{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"Token":        pair.AccessToken,
+			"RefreshToken": pair.RefreshToken,
+			"ExpiresIn":    int(token.AccessTokenTTL.Seconds()),
+		},
+	})
+}
+
+// LogOut revokes the current session, or every session of the user when "all" is set
+func (ac *AuthController) LogOut(c *gin.Context) {
+	var req logOutRequest
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	sessions, userID := ac.store.Sessions(), c.GetUint("user_id")
+	var err error
+	if req.All {
+		err = sessions.RevokeAll(c.Request.Context(), userID)
+	} else {
+		err = sessions.Revoke(c.Request.Context(), userID, c.GetString("session_id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
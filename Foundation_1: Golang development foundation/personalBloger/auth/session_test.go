@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"personalBloger/token"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sessionRouter(ac *AuthController) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", ac.LogIn)
+	r.POST("/refresh", ac.Refresh)
+	return r
+}
+
+// refreshToken returns the refresh token in a login or refresh response
+func refreshToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Data struct{ RefreshToken string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.RefreshToken == "" {
+		t.Fatalf("status %d, body %s, want a refresh token", w.Code, w.Body)
+	}
+	return resp.Data.RefreshToken
+}
+
+func refresh(r *gin.Engine, plain string) *httptest.ResponseRecorder {
+	return call(r, "POST", "/refresh", `{"refresh_token":"`+plain+`"}`)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db, store := openStore(t)
+	createUser(t, db, store, "alice", "alice@example.com", true)
+	r := sessionRouter(NewAuthController(store))
+	login := `{"username":"alice","password":"password123"}`
+
+	first := refreshToken(t, call(r, "POST", "/login", login))
+	other := refreshToken(t, call(r, "POST", "/login", login))
+	w := refresh(r, first)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %s", w.Code, w.Body)
+	}
+	second := refreshToken(t, w)
+
+	// The rotated-out token turns up again, so it was copied
+	if w := refresh(r, first); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh with a used token: status %d, want 401", w.Code)
+	}
+	stored, err := store.Sessions().FindRefreshToken(context.Background(), token.Hash(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := store.Sessions().FindByID(context.Background(), stored.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.IsActive() {
+		t.Error("the session is still active after its refresh token was reused")
+	}
+	if w := refresh(r, second); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with the token issued before the reuse: status %d, want 401", w.Code)
+	}
+
+	// Other sessions of the user are not affected
+	if w := refresh(r, other); w.Code != http.StatusOK {
+		t.Errorf("refresh in another session: status %d, want 200", w.Code)
+	}
+}
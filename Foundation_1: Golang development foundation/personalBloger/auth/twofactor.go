@@ -0,0 +1,407 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"net/http"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"personalBloger/token"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpIssuer is the name authenticator apps show next to the account
+	totpIssuer = "Personal Blogger"
+	// totpPeriod is how long one code is valid; one step of clock drift is accepted either way
+	totpPeriod = 30
+	// ChallengeTTL is how long a login has to enter the second factor
+	ChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts is how many wrong codes a challenge takes before it is dropped
+	maxChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidChallenge = errors.New("Invalid or expired challenge, please log in again")
+	errInvalidCode      = errors.New("Invalid code")
+)
+
+type codeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type challengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// totpOptions are the parameters every authenticator app supports
+var totpOptions = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// checkTOTP accepts a code of the current time step or a neighbouring one, and
+// only once
+func checkTOTP(ctx context.Context, twoFactor repository.TwoFactorRepository, tf *model.TwoFactor, code string) (bool, error) {
+	now := time.Now()
+	for _, offset := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(tf.Secret, at, totpOptions)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return twoFactor.AcceptTOTPStep(ctx, tf.UserID, at.Unix()/totpPeriod)
+		}
+	}
+	return false, nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes with any case and spacing
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code of the user
+func checkSecondFactor(ctx context.Context, twoFactor repository.TwoFactorRepository, tf *model.TwoFactor, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == int(otp.DigitsSix) {
+		return checkTOTP(ctx, twoFactor, tf, code)
+	}
+	return twoFactor.UseRecoveryCode(ctx, tf.UserID, token.Hash(normalizeRecoveryCode(code)))
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new ones,
+// formatted as xxxxx-xxxxx
+func newRecoveryCodes(ctx context.Context, twoFactor repository.TwoFactorRepository, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		// base32 has no 0, 1, 8 or 9 to mix up with letters
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = token.Hash(raw)
+	}
+	if err := twoFactor.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// issueChallenge stores a login challenge for the user and returns its plaintext
+func (ac *AuthController) issueChallenge(ctx context.Context, user *model.User) (string, error) {
+	plain := token.RandomString(32)
+	err := ac.store.TwoFactor().CreateChallenge(ctx, &model.TwoFactorChallenge{
+		UserID:    user.ID,
+		TokenHash: token.Hash(plain),
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// challengeSecondFactor responds with a login challenge when the user has
+// two-factor authentication on and reports whether it responded. Every way of
+// logging in calls it before respondWithSession, so neither a password nor an
+// identity provider alone is enough.
+func (ac *AuthController) challengeSecondFactor(c *gin.Context, user *model.User) bool {
+	tf, err := ac.store.TwoFactor().Find(c.Request.Context(), user.ID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !tf.IsEnabled()) {
+		return false
+	}
+	var challenge string
+	if err == nil {
+		challenge, err = ac.issueChallenge(c.Request.Context(), user)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return true
+	}
+	c.JSON(http.StatusOK, AuthResponse{
+		Code:    200,
+		Message: "two_factor_required",
+		Data: gin.H{
+			"ChallengeToken": challenge,
+			"ExpiresIn":      int(ChallengeTTL.Seconds()),
+		},
+	})
+	return true
+}
+
+// findEnabledTwoFactor loads the caller's TOTP settings, responding with 400 if
+// two-factor authentication is not on
+func (ac *AuthController) findEnabledTwoFactor(c *gin.Context) (*model.TwoFactor, bool) {
+	tf, err := ac.store.TwoFactor().Find(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil || !tf.IsEnabled() {
+		c.JSON(400, gin.H{"error": "Two-factor authentication is not enabled"})
+		return nil, false
+	}
+	return tf, true
+}
+
+// TwoFactorStatus reports whether two-factor authentication is on and how many
+// recovery codes are left
+func (ac *AuthController) TwoFactorStatus(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	enabled := false
+	if tf, err := ac.store.TwoFactor().Find(c.Request.Context(), userID); err == nil {
+		enabled = tf.IsEnabled()
+	}
+	left, err := ac.store.TwoFactor().CountRecoveryCodes(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled, "recovery_codes_left": left})
+}
+
+// EnrollTwoFactor creates a new pending TOTP secret and returns it as a
+// provisioning URI and QR code for authenticator apps
+func (ac *AuthController) EnrollTwoFactor(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if tf, err := ac.store.TwoFactor().Find(c.Request.Context(), userID); err == nil && tf.IsEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: c.GetString("username"),
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a secret"})
+		return
+	}
+	qr, err := key.Image(256, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a QR code"})
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, qr); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a QR code"})
+		return
+	}
+	if err := ac.store.TwoFactor().Enroll(c.Request.Context(), &model.TwoFactor{UserID: userID, Secret: key.Secret()}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save the secret"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           key.Secret(),
+		"provisioning_uri": key.URL(),
+		"qr_code":          "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+}
+
+// EnableTwoFactor turns two-factor authentication on once a code from the
+// enrolled authenticator checks out, and returns the first recovery codes
+func (ac *AuthController) EnableTwoFactor(c *gin.Context) {
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("user_id")
+	ctx := c.Request.Context()
+	tf, err := ac.store.TwoFactor().Find(ctx, userID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Enroll an authenticator first"})
+		return
+	}
+	if tf.IsEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	var codes []string
+	err = ac.store.Transaction(ctx, func(s repository.Store) error {
+		ok, err := checkTOTP(ctx, s.TwoFactor(), tf, strings.TrimSpace(req.Code))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidCode
+		}
+		if err := s.TwoFactor().Enable(ctx, tf); err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(ctx, s.TwoFactor(), userID)
+		return err
+	})
+	if errors.Is(err, errInvalidCode) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled, keep the recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a TOTP
+// or recovery code
+func (ac *AuthController) DisableTwoFactor(c *gin.Context) {
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tf, ok := ac.findEnabledTwoFactor(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		ok, err := checkSecondFactor(ctx, s.TwoFactor(), tf, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidCode
+		}
+		return s.TwoFactor().Disable(ctx, tf.UserID)
+	})
+	if errors.Is(err, errInvalidCode) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP or
+// recovery code
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req codeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	tf, ok := ac.findEnabledTwoFactor(c)
+	if !ok {
+		return
+	}
+	var codes []string
+	ctx := c.Request.Context()
+	err := ac.store.Transaction(ctx, func(s repository.Store) error {
+		ok, err := checkSecondFactor(ctx, s.TwoFactor(), tf, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidCode
+		}
+		codes, err = newRecoveryCodes(ctx, s.TwoFactor(), tf.UserID)
+		return err
+	})
+	if errors.Is(err, errInvalidCode) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyTwoFactor exchanges a login challenge and a TOTP or recovery code for
+// the tokens LogIn returns to users without two-factor authentication. Wrong
+// codes count as failed logins.
+func (ac *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var req challengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	challenge, err := ac.store.TwoFactor().FindChallenge(ctx, token.Hash(req.ChallengeToken))
+	if err != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+	user, err := ac.store.Users().FindByID(ctx, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+	tf, err := ac.store.TwoFactor().Find(ctx, user.ID)
+	if err != nil || !tf.IsEnabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+	attempt, ok := ac.reserveLoginAttempt(c, user.Username)
+	if !ok {
+		return
+	}
+	// Counting the attempt on the challenge before checking the code keeps
+	// concurrent guesses within maxChallengeAttempts
+	counted, err := ac.store.TwoFactor().CountChallengeAttempt(ctx, challenge, maxChallengeAttempts)
+	if err != nil || !counted {
+		ac.releaseLoginAttempt(c, attempt)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+
+	err = ac.store.Transaction(ctx, func(s repository.Store) error {
+		ok, err := checkSecondFactor(ctx, s.TwoFactor(), tf, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidCode
+		}
+		// The challenge is used up; deleting it fails a concurrent second use
+		deleted, err := s.TwoFactor().DeleteChallenge(ctx, challenge)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return errInvalidChallenge
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidCode) {
+		ac.loginFailed(c, user.Username, attempt)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	ac.releaseLoginAttempt(c, attempt)
+	if errors.Is(err, errInvalidChallenge) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if err := ac.store.LoginFailures().Clear(ctx, model.AccountLoginSubject(user.Username)); err != nil {
+		c.Error(err)
+	}
+	ac.respondWithSession(c, user)
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"personalBloger/token"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// testSecret is the TOTP secret of the test user
+	testSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	// testRecoveryCode is the only recovery code of the test user
+	testRecoveryCode = "abcde-fghij"
+)
+
+// twoFactorUser creates a user with two-factor authentication on, using
+// testSecret and testRecoveryCode
+func twoFactorUser(t *testing.T, store repository.Store, username string) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	user := &model.User{Username: username, Email: username + "@example.com", Password: "password123"}
+	if err := store.Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	tf := &model.TwoFactor{UserID: user.ID, Secret: testSecret}
+	if err := store.TwoFactor().Enroll(ctx, tf); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TwoFactor().Enable(ctx, tf); err != nil {
+		t.Fatal(err)
+	}
+	hash := token.Hash(normalizeRecoveryCode(testRecoveryCode))
+	if err := store.TwoFactor().ReplaceRecoveryCodes(ctx, user.ID, []string{hash}); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// totpCode returns the code of testSecret at the time step of at
+func totpCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(testSecret, at, totpOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// permissiveLockout lets a test fail as often as it needs without being throttled
+func permissiveLockout(t *testing.T) {
+	t.Helper()
+	SetLockoutPolicy(LockoutPolicy{MaxFailures: 100, IPMaxFailures: 100, Duration: time.Minute, FreeFailures: 100})
+	t.Cleanup(func() { SetLockoutPolicy(DefaultLockoutPolicy) })
+}
+
+func twoFactorRouter(ac *AuthController) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", ac.LogIn)
+	r.POST("/2fa/verify", ac.VerifyTwoFactor)
+	return r
+}
+
+// challenge logs in with the password and returns the challenge token
+func challenge(t *testing.T, r *gin.Engine, username string) string {
+	t.Helper()
+	w := call(r, "POST", "/login", `{"username":"`+username+`","password":"password123"}`)
+	var resp struct {
+		Message string
+		Data    struct{ ChallengeToken string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Message != "two_factor_required" {
+		t.Fatalf("log in: status %d, body %s, want a challenge", w.Code, w.Body)
+	}
+	return resp.Data.ChallengeToken
+}
+
+func verify(r *gin.Engine, challengeToken, code string) int {
+	return call(r, "POST", "/2fa/verify", `{"challenge_token":"`+challengeToken+`","code":"`+code+`"}`).Code
+}
+
+func TestTOTPCodeWorksOnce(t *testing.T) {
+	_, store := openStore(t)
+	permissiveLockout(t)
+	twoFactorUser(t, store, "alice")
+	r := twoFactorRouter(NewAuthController(store))
+
+	code := totpCode(t, time.Now())
+	if got := verify(r, challenge(t, r, "alice"), code); got != http.StatusOK {
+		t.Fatalf("verify: status %d, want 200", got)
+	}
+	if got := verify(r, challenge(t, r, "alice"), code); got != http.StatusUnauthorized {
+		t.Errorf("verify with a used code: status %d, want 401", got)
+	}
+
+	// Once a later step was used, the codes before it are spent too
+	if got := verify(r, challenge(t, r, "alice"), totpCode(t, time.Now().Add(totpPeriod*time.Second))); got != http.StatusOK {
+		t.Fatalf("verify with the next step: status %d, want 200", got)
+	}
+	if got := verify(r, challenge(t, r, "alice"), totpCode(t, time.Now().Add(-totpPeriod*time.Second))); got != http.StatusUnauthorized {
+		t.Errorf("verify with an earlier step: status %d, want 401", got)
+	}
+}
+
+func TestRecoveryCodeWorksOnce(t *testing.T) {
+	_, store := openStore(t)
+	permissiveLockout(t)
+	user := twoFactorUser(t, store, "bob")
+	r := twoFactorRouter(NewAuthController(store))
+
+	// Recovery codes may be typed in any case and spacing
+	if got := verify(r, challenge(t, r, "bob"), "ABCDE FGHIJ"); got != http.StatusOK {
+		t.Fatalf("verify with a recovery code: status %d, want 200", got)
+	}
+	if got := verify(r, challenge(t, r, "bob"), testRecoveryCode); got != http.StatusUnauthorized {
+		t.Errorf("verify with a used recovery code: status %d, want 401", got)
+	}
+	if left, err := store.TwoFactor().CountRecoveryCodes(context.Background(), user.ID); err != nil || left != 0 {
+		t.Errorf("CountRecoveryCodes() = %d, %v, want 0", left, err)
+	}
+}
+
+func TestChallengeDroppedAfterMaxAttempts(t *testing.T) {
+	_, store := openStore(t)
+	permissiveLockout(t)
+	twoFactorUser(t, store, "carol")
+	r := twoFactorRouter(NewAuthController(store))
+
+	challengeToken := challenge(t, r, "carol")
+	for i := 0; i < maxChallengeAttempts; i++ {
+		if got := verify(r, challengeToken, "000000"); got != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status %d, want 401", i+1, got)
+		}
+	}
+	if got := verify(r, challengeToken, totpCode(t, time.Now())); got != http.StatusUnauthorized {
+		t.Errorf("right code after %d wrong ones: status %d, want 401", maxChallengeAttempts, got)
+	}
+	if got := verify(r, challenge(t, r, "carol"), totpCode(t, time.Now())); got != http.StatusOK {
+		t.Errorf("right code on a new challenge: status %d, want 200", got)
+	}
+}
@@ -0,0 +1,209 @@
+// Package config holds the settings of the blog server. They are read from a
+// YAML or TOML file, then environment variables, then command-line flags, each
+// overriding the one before; see Load.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"personalBloger/auth"
+	"personalBloger/feed"
+	"personalBloger/model"
+	"personalBloger/token"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config holds every setting, grouped in sections. Each setting carries its
+// file key (yaml and toml), the environment variable that overrides it and a
+// usage line for its flag. The flag is named after the section and the key,
+// such as -server.addr. Settings tagged secret are redacted when the
+// configuration is printed.
+type Config struct {
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Log      Log      `yaml:"log" toml:"log"`
+	CORS     CORS     `yaml:"cors" toml:"cors"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	Lockout  Lockout  `yaml:"lockout" toml:"lockout"`
+	OIDC     OIDC     `yaml:"oidc" toml:"oidc"`
+	Mail     Mail     `yaml:"mail" toml:"mail"`
+	Storage  Storage  `yaml:"storage" toml:"storage"`
+	Feed     Feed     `yaml:"feed" toml:"feed"`
+	Search   Search   `yaml:"search" toml:"search"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr" toml:"addr" env:"LISTEN_ADDR" usage:"address the server listens on"`
+	// TrustedProxies may set X-Forwarded-For, which rate limits are keyed by
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"proxies whose X-Forwarded-For header is trusted"`
+}
+
+type Database struct {
+	DSN string `yaml:"dsn" toml:"dsn" env:"DATABASE_DSN" usage:"SQLite database file or DSN"`
+}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL" usage:"debug, info, warn or error"`
+}
+
+// CORS is off while AllowedOrigins is empty
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"origins allowed to call the API, * for any"`
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS" usage:"methods allowed in cross-origin requests"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" usage:"request headers allowed in cross-origin requests"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" usage:"response headers scripts may read"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"allow cookies and credentials in cross-origin requests"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers may cache a preflight response"`
+}
+
+type Auth struct {
+	JWTSecret       string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true" usage:"HS256 signing secret, at least 32 characters"`
+	JWTKeysFile     string        `yaml:"jwt_keys_file" toml:"jwt_keys_file" env:"JWT_KEYS_FILE" usage:"JSON file with rotating signing keys, takes precedence over jwt_secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" usage:"how long access tokens stay valid"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" usage:"how long refresh tokens and sessions stay valid"`
+	AdminUsernames  []string      `yaml:"admin_usernames" toml:"admin_usernames" env:"ADMIN_USERNAMES" usage:"users promoted to admin on startup"`
+	// UnverifiedPolicy is allow, read_only or block, see model.UnverifiedPolicy
+	UnverifiedPolicy string `yaml:"unverified_policy" toml:"unverified_policy" env:"UNVERIFIED_POLICY" usage:"what unverified users may do: allow, read_only or block"`
+}
+
+type Lockout struct {
+	MaxFailures   int           `yaml:"max_failures" toml:"max_failures" env:"LOGIN_MAX_FAILURES" usage:"failed logins that lock an account"`
+	IPMaxFailures int           `yaml:"ip_max_failures" toml:"ip_max_failures" env:"LOGIN_IP_MAX_FAILURES" usage:"failed logins that lock a client IP"`
+	Duration      time.Duration `yaml:"duration" toml:"duration" env:"LOGIN_LOCKOUT" usage:"how long a lockout lasts"`
+}
+
+// OIDC login is off while Issuer is empty
+type OIDC struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER" usage:"OpenID Connect provider URL"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID" usage:"client ID at the provider"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" usage:"client secret at the provider"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL" usage:"callback URL registered at the provider"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"OIDC_SCOPES" usage:"scopes to request besides openid"`
+}
+
+type Mail struct {
+	Mailer       string `yaml:"mailer" toml:"mailer" env:"MAILER" usage:"log, file or smtp"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM" usage:"sender address"`
+	Dir          string `yaml:"dir" toml:"dir" env:"MAIL_DIR" usage:"directory for .eml files of the file mailer"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST" usage:"SMTP server"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT" usage:"SMTP port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP user"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+}
+
+type Storage struct {
+	Backend           string `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND" usage:"local or s3"`
+	MediaDir          string `yaml:"media_dir" toml:"media_dir" env:"MEDIA_DIR" usage:"directory for uploads of the local backend"`
+	S3Endpoint        string `yaml:"s3_endpoint" toml:"s3_endpoint" env:"S3_ENDPOINT" usage:"S3-compatible endpoint"`
+	S3Region          string `yaml:"s3_region" toml:"s3_region" env:"S3_REGION" usage:"S3 region"`
+	S3Bucket          string `yaml:"s3_bucket" toml:"s3_bucket" env:"S3_BUCKET" usage:"S3 bucket"`
+	S3AccessKeyID     string `yaml:"s3_access_key_id" toml:"s3_access_key_id" env:"S3_ACCESS_KEY_ID" usage:"S3 access key ID"`
+	S3SecretAccessKey string `yaml:"s3_secret_access_key" toml:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true" usage:"S3 secret access key"`
+}
+
+type Feed struct {
+	Title       string `yaml:"title" toml:"title" env:"FEED_TITLE" usage:"feed title"`
+	Description string `yaml:"description" toml:"description" env:"FEED_DESCRIPTION" usage:"feed description"`
+	// Content is summary or full
+	Content string `yaml:"content" toml:"content" env:"FEED_CONTENT" usage:"summary or full post content in feeds"`
+	SiteURL string `yaml:"site_url" toml:"site_url" env:"SITE_URL" usage:"public URL of the blog, used in feeds and emails"`
+}
+
+// Search needs SQLite built with FTS5; without it the server refuses to start
+// unless search is disabled
+type Search struct {
+	Disabled bool `yaml:"disabled" toml:"disabled" env:"SEARCH_DISABLED" usage:"run without full-text search, for SQLite built without FTS5"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	feedSettings := feed.Current()
+	return Config{
+		Server:   Server{Addr: ":8080"},
+		Database: Database{DSN: "blog.db"},
+		Log:      Log{Level: "info"},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type"},
+			ExposedHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"},
+			MaxAge:         10 * time.Minute,
+		},
+		Auth: Auth{
+			AccessTokenTTL:   token.AccessTokenTTL,
+			RefreshTokenTTL:  token.RefreshTokenTTL,
+			UnverifiedPolicy: string(model.UnverifiedAllow),
+		},
+		Lockout: Lockout{
+			MaxFailures:   auth.DefaultLockoutPolicy.MaxFailures,
+			IPMaxFailures: auth.DefaultLockoutPolicy.IPMaxFailures,
+			Duration:      auth.DefaultLockoutPolicy.Duration,
+		},
+		Mail:    Mail{Mailer: "log", From: "blog@localhost", Dir: "outbox", SMTPPort: 587},
+		Storage: Storage{Backend: "local", MediaDir: "uploads"},
+		Feed: Feed{
+			Title:       feedSettings.Title,
+			Description: feedSettings.Description,
+			Content:     string(feedSettings.Content),
+			SiteURL:     feedSettings.BaseURL,
+		},
+	}
+}
+
+// Validate reports every setting that is missing or out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(value string, allowed ...string) bool {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Database.DSN != "", "database.dsn is required")
+	_, err := logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level %q is not a log level", c.Log.Level)
+
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+	if c.CORS.AllowCredentials {
+		check(!oneOf("*", c.CORS.AllowedOrigins...), "cors.allow_credentials cannot be used with the * origin")
+	}
+
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "auth.jwt_secret must be at least 32 characters")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+	check(model.ValidUnverifiedPolicy(model.UnverifiedPolicy(c.Auth.UnverifiedPolicy)), "auth.unverified_policy %q must be allow, read_only or block", c.Auth.UnverifiedPolicy)
+
+	check(c.Lockout.MaxFailures >= 1, "lockout.max_failures must be at least 1")
+	check(c.Lockout.IPMaxFailures >= 1, "lockout.ip_max_failures must be at least 1")
+	check(c.Lockout.Duration > 0, "lockout.duration must be positive")
+
+	if c.OIDC.Issuer != "" {
+		check(c.OIDC.ClientID != "", "oidc.client_id is required with oidc.issuer")
+	}
+
+	check(oneOf(c.Mail.Mailer, "log", "file", "smtp"), "mail.mailer %q must be log, file or smtp", c.Mail.Mailer)
+	check(c.Mail.From != "", "mail.from is required")
+	if c.Mail.Mailer == "smtp" {
+		check(c.Mail.SMTPHost != "", "mail.smtp_host is required with the smtp mailer")
+		check(c.Feed.SiteURL != "", "feed.site_url is required with the smtp mailer, email links are built from it")
+	}
+	check(c.Mail.SMTPPort >= 1 && c.Mail.SMTPPort <= 65535, "mail.smtp_port %d is not a port", c.Mail.SMTPPort)
+
+	check(oneOf(c.Storage.Backend, "local", "s3"), "storage.backend %q must be local or s3", c.Storage.Backend)
+	if c.Storage.Backend == "s3" {
+		check(c.Storage.S3Bucket != "", "storage.s3_bucket is required with the s3 backend")
+	}
+
+	check(oneOf(c.Feed.Content, string(feed.ContentSummary), string(feed.ContentFull)), "feed.content %q must be summary or full", c.Feed.Content)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Default().Validate() error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"no address", func(c *Config) { c.Server.Addr = "" }, "server.addr is required"},
+		{"unknown log level", func(c *Config) { c.Log.Level = "loud" }, `log.level "loud" is not a log level`},
+		{"credentials with any origin", func(c *Config) {
+			c.CORS.AllowCredentials = true
+			c.CORS.AllowedOrigins = []string{"https://example.com", "*"}
+		}, "cors.allow_credentials cannot be used with the * origin"},
+		{"short secret", func(c *Config) { c.Auth.JWTSecret = "short" }, "auth.jwt_secret must be at least 32 characters"},
+		{"refresh shorter than access", func(c *Config) { c.Auth.RefreshTokenTTL = time.Minute }, "auth.refresh_token_ttl must be longer"},
+		{"unknown unverified policy", func(c *Config) { c.Auth.UnverifiedPolicy = "ignore" }, `auth.unverified_policy "ignore"`},
+		{"no lockout", func(c *Config) { c.Lockout.MaxFailures = 0 }, "lockout.max_failures must be at least 1"},
+		{"issuer without client", func(c *Config) { c.OIDC.Issuer = "https://accounts.example.com" }, "oidc.client_id is required"},
+		{"unknown mailer", func(c *Config) { c.Mail.Mailer = "pigeon" }, `mail.mailer "pigeon" must be log, file or smtp`},
+		{"smtp without host", func(c *Config) { c.Mail.Mailer = "smtp" }, "mail.smtp_host is required"},
+		{"smtp without site url", func(c *Config) {
+			c.Mail.Mailer = "smtp"
+			c.Mail.SMTPHost = "mail.example.com"
+		}, "feed.site_url is required with the smtp mailer"},
+		{"port out of range", func(c *Config) { c.Mail.SMTPPort = 70000 }, "mail.smtp_port 70000 is not a port"},
+		{"s3 without bucket", func(c *Config) { c.Storage.Backend = "s3" }, "storage.s3_bucket is required"},
+		{"unknown feed content", func(c *Config) { c.Feed.Content = "teaser" }, `feed.content "teaser" must be summary or full`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Addr = ""
+	cfg.Database.DSN = ""
+	cfg.Lockout.Duration = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil")
+	}
+	for _, want := range []string{"server.addr", "database.dsn", "lockout.duration"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// redacted replaces the value of secret settings when the configuration is printed
+const redacted = "[redacted]"
+
+// ErrUsage means the command line was invalid; the flag package has already
+// printed the problem and the usage
+var ErrUsage = errors.New("invalid command line")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is one field of Config with the names it goes by
+type setting struct {
+	// key is section.key as in the file; the flag has the same name
+	key    string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists every field of cfg, pointing into cfg
+func settings(cfg *Config) []setting {
+	var list []setting
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		fields := root.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			field := fields.Type().Field(j)
+			list = append(list, setting{
+				key:    section.Tag.Get("yaml") + "." + field.Tag.Get("yaml"),
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  fields.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// splitList splits a list given as one string at commas and spaces
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
+
+// set parses raw into the setting
+func (s setting) set(raw string) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration such as 90s or 15m", s.key, raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", s.key, raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", s.key, raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", s.key, v.Type())
+	}
+	return nil
+}
+
+// setFromFile stores a value decoded from YAML or TOML, which may be a list
+func (s setting) setFromFile(raw interface{}) error {
+	switch raw := raw.(type) {
+	case nil:
+		return s.set("")
+	case []interface{}:
+		if s.value.Kind() != reflect.Slice {
+			return fmt.Errorf("%s: expected a single value, not a list", s.key)
+		}
+		items := make([]string, 0, len(raw))
+		for _, item := range raw {
+			items = append(items, fmt.Sprint(item))
+		}
+		s.value.Set(reflect.ValueOf(items))
+		return nil
+	case map[string]interface{}:
+		return fmt.Errorf("%s: expected a value, not a table", s.key)
+	default:
+		return s.set(fmt.Sprint(raw))
+	}
+}
+
+// display returns the value as it is printed, with secrets redacted
+func (s setting) display() interface{} {
+	if s.secret && !s.value.IsZero() {
+		return redacted
+	}
+	if s.value.Type() == durationType {
+		return time.Duration(s.value.Int()).String()
+	}
+	if s.value.Kind() == reflect.Slice && s.value.Len() == 0 {
+		return []string{}
+	}
+	return s.value.Interface()
+}
+
+// Load builds the configuration from the defaults, the file named by -config or
+// CONFIG_FILE, environment variables and the flags in args, in that order, and
+// validates it. It returns the arguments after the flags, such as a subcommand.
+// For -h it returns flag.ErrHelp and for other flag errors ErrUsage.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	list := settings(&cfg)
+
+	// Flags are applied last but parsed first, since they can name the file
+	fs := flag.NewFlagSet("personalBloger", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] [command]\n\nflags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (env CONFIG_FILE)")
+	type flagValue struct {
+		setting setting
+		raw     string
+	}
+	var flagValues []flagValue
+	for _, s := range list {
+		s := s
+		usage := s.usage + " (env " + s.env + ")"
+		record := func(raw string) error {
+			flagValues = append(flagValues, flagValue{s, raw})
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(s.key, usage, record)
+		} else {
+			fs.Func(s.key, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, ErrUsage
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, list); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range list {
+		if raw := os.Getenv(s.env); raw != "" {
+			if err := s.set(raw); err != nil {
+				return nil, nil, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, f := range flagValues {
+		if err := f.setting.set(f.raw); err != nil {
+			return nil, nil, fmt.Errorf("flag -%w", err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// loadFile applies a YAML (.yaml, .yml) or TOML (.toml) file. Unknown sections
+// and keys are errors so that typos do not go unnoticed.
+func loadFile(path string, list []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return errors.New("config file " + path + " must end in .yaml, .yml or .toml")
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(list))
+	for _, s := range list {
+		byKey[s.key] = s
+	}
+	for section, values := range doc {
+		table, ok := values.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("config file %s: %s must be a section", path, section)
+		}
+		for key, raw := range table {
+			s, ok := byKey[section+"."+key]
+			if !ok {
+				return fmt.Errorf("config file %s: unknown setting %s.%s", path, section, key)
+			}
+			if err := s.setFromFile(raw); err != nil {
+				return fmt.Errorf("config file %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// String returns the configuration as YAML with secrets redacted, so it can be
+// printed or logged safely
+func (c Config) String() string {
+	var doc yaml.MapSlice
+	var section *yaml.MapItem
+	for _, s := range settings(&c) {
+		name, key, _ := strings.Cut(s.key, ".")
+		if section == nil || section.Key != name {
+			doc = append(doc, yaml.MapItem{Key: name, Value: yaml.MapSlice{}})
+			section = &doc[len(doc)-1]
+		}
+		section.Value = append(section.Value.(yaml.MapSlice), yaml.MapItem{Key: key, Value: s.display()})
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return "# " + err.Error()
+	}
+	return string(out)
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile stores contents as name in a temporary directory and returns the path
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "blog.yaml", "log:\n  level: warn\n")
+	tomlFile := writeFile(t, "blog.toml", "[log]\nlevel = \"warn\"\n")
+	tests := []struct {
+		name string
+		file string
+		env  string
+		args []string
+		want string
+	}{
+		{"default", "", "", nil, "info"},
+		{"yaml file", yamlFile, "", nil, "warn"},
+		{"toml file", tomlFile, "", nil, "warn"},
+		{"env over file", yamlFile, "error", nil, "error"},
+		{"flag over env", yamlFile, "error", []string{"-log.level", "debug"}, "debug"},
+		{"flag over file", yamlFile, "", []string{"-log.level=debug"}, "debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", tt.file)
+			t.Setenv("LOG_LEVEL", tt.env)
+			cfg, _, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Log.Level != tt.want {
+				t.Errorf("log.level = %q, want %q", cfg.Log.Level, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFlagNamesFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "env.yaml", "log:\n  level: warn\n"))
+	t.Setenv("LOG_LEVEL", "")
+	flagFile := writeFile(t, "flag.yaml", "log:\n  level: error\n")
+	cfg, args, err := Load([]string{"-config", flagFile, "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("log.level = %q, want error from the file named by -config", cfg.Log.Level)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args = %q, want the command after the flags", args)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  string
+		want string
+	}{
+		{"unknown key", "log:\n  colour: true\n", "", "unknown setting log.colour"},
+		{"list for a single value", "log:\n  level: [a, b]\n", "", "log.level: expected a single value"},
+		{"bad duration", "", "15 minutes", "env LOGIN_LOCKOUT"},
+		{"invalid value", "mail:\n  mailer: pigeon\n", "", "invalid configuration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := ""
+			if tt.file != "" {
+				file = writeFile(t, "blog.yaml", tt.file)
+			}
+			t.Setenv("CONFIG_FILE", file)
+			t.Setenv("LOGIN_LOCKOUT", tt.env)
+			_, _, err := Load(nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = "jwt-secret-0123456789abcdef0123456789"
+	cfg.OIDC.ClientSecret = "oidc-client-secret"
+	cfg.Mail.SMTPPassword = "smtp-password"
+	cfg.Storage.S3SecretAccessKey = "s3-secret-access-key"
+	cfg.Storage.S3AccessKeyID = "AKIDEXAMPLE"
+
+	out := cfg.String()
+	for _, secret := range []string{cfg.Auth.JWTSecret, cfg.OIDC.ClientSecret, cfg.Mail.SMTPPassword, cfg.Storage.S3SecretAccessKey} {
+		if strings.Contains(out, secret) {
+			t.Errorf("String() shows the secret %q:\n%s", secret, out)
+		}
+	}
+	for _, key := range []string{"jwt_secret", "client_secret", "smtp_password", "s3_secret_access_key"} {
+		if !strings.Contains(out, key+`: "`+redacted+`"`) {
+			t.Errorf("String() does not redact %s:\n%s", key, out)
+		}
+	}
+	if !strings.Contains(out, "s3_access_key_id: AKIDEXAMPLE") {
+		t.Errorf("String() hides a setting that is not secret:\n%s", out)
+	}
+}
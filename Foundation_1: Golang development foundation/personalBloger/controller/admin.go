@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"personalBloger/middleware"
+	"personalBloger/model"
+	"personalBloger/rbac"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type AdminController struct{}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (ac *AdminController) ListUsers(c *gin.Context) {
+	var users []model.User
+	if err := model.DB.Order("id").Find(&users).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get users"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"count": len(users),
+		"users": users,
+	})
+}
+
+func (ac *AdminController) UpdateRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	role, ok := rbac.ParseRole(req.Role)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Unknown role"})
+		return
+	}
+	if uint(userID) == c.GetUint("user_id") {
+		c.JSON(400, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	var user model.User
+	if err := model.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	// Role claims live in access tokens, so revoke the user's sessions to make
+	// the new role take effect on their next login.
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", role).Error; err != nil {
+			return err
+		}
+		return model.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update role"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Role updated successfully"})
+}
+
+func (ac *AdminController) UnlockUser(c *gin.Context) {
+	// POST /admin/users/:id/unlock ends a login lockout of the account. Lockouts
+	// of client IPs expire on their own.
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var user model.User
+	if err := model.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	if err := model.ClearLoginFailures(model.DB, model.AccountLoginSubject(user.Username)); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	middleware.GetLogger().WithFields(logrus.Fields{
+		"event":    "login_unlocked",
+		"username": user.Username,
+		"admin_id": c.GetUint("user_id"),
+	}).Info("account unlocked by an administrator")
+	c.JSON(200, gin.H{"message": "User unlocked successfully"})
+}
+
+func (ac *AdminController) DeleteUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if uint(userID) == c.GetUint("user_id") {
+		c.JSON(400, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	var user model.User
+	if err := model.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return model.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete user"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "User deleted successfully"})
+}
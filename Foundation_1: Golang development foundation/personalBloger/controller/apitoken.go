@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"personalBloger/model"
+	"personalBloger/rbac"
+	"personalBloger/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APITokenController struct{}
+
+// CreateAPITokenRequest describes a new personal access token. ExpiresAt is
+// optional; tokens without it stay valid until they are revoked.
+type CreateAPITokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (ac *APITokenController) ListTokens(c *gin.Context) {
+	// GET /tokens lists the caller's tokens without their secrets
+	var tokens []model.APIToken
+	if err := model.DB.Where("user_id = ?", c.GetUint("user_id")).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+	c.JSON(200, gin.H{"count": len(tokens), "tokens": tokens})
+}
+
+func (ac *APITokenController) CreateToken(c *gin.Context) {
+	// POST /tokens returns the token once; only its hash is kept
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var scopes []rbac.TokenScope
+	seen := make(map[rbac.TokenScope]bool)
+	for _, s := range req.Scopes {
+		scope, ok := rbac.ParseTokenScope(s)
+		if !ok {
+			c.JSON(400, gin.H{"error": "Unknown scope: " + s})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	plain := token.NewPersonalToken()
+	apiToken := model.APIToken{
+		UserID:    c.GetUint("user_id"),
+		Name:      req.Name,
+		Prefix:    plain[:len(token.PersonalTokenPrefix)+6],
+		TokenHash: token.Hash(plain),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := model.DB.Create(&apiToken).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create token"})
+		return
+	}
+	c.JSON(201, gin.H{
+		"message": "Token created, copy it now as it will not be shown again",
+		"token":   plain,
+		"data":    apiToken,
+	})
+}
+
+func (ac *APITokenController) DeleteToken(c *gin.Context) {
+	// DELETE /tokens/:id revokes one of the caller's tokens
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid token ID"})
+		return
+	}
+	result := model.DB.Where("id = ? AND user_id = ?", tokenID, c.GetUint("user_id")).Delete(&model.APIToken{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Token not found"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Token revoked"})
+}
@@ -1,17 +1,39 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"personalBloger/model"
+	"personalBloger/repository"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-type CommentController struct{}
+type CommentController struct {
+	store repository.Store
+}
+
+// NewCommentController returns a CommentController that works on store
+func NewCommentController(store repository.Store) *CommentController {
+	return &CommentController{store: store}
+}
 
 type CreateCommentRequest struct {
 	PostID  uint   `json:"post_id" gorm:"not null;index"`
 	Content string `json:"content" binding:"required"`
+	// ParentID makes the comment a reply to another comment on the same post
+	ParentID *uint `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// CommentNode is a comment with its replies, used by the tree format
+type CommentNode struct {
+	model.Comment
+	Replies []*CommentNode `json:"replies"`
 }
 
 func (cc *CommentController) CreateComment(c *gin.Context) {
@@ -40,38 +62,268 @@ func (cc *CommentController) CreateComment(c *gin.Context) {
 		return
 	}
 
-	// Validate that the post exists
-	var post model.Post
-	if err := model.DB.Where("id = ?", req.PostID).First(&post).Error; err != nil {
+	// Validate that the post exists and the user can see it
+	ctx := c.Request.Context()
+	post, err := cc.store.Posts().FindVisible(ctx, req.PostID, userIDUint)
+	if err != nil {
 		c.JSON(404, gin.H{"error": "Post not found"})
 		return
 	}
 
 	comment := model.Comment{
-		PostID:  req.PostID,
-		Content: req.Content,
-		UserID:  userIDUint,
+		PostID:   req.PostID,
+		ParentID: req.ParentID,
+		Content:  req.Content,
+		UserID:   userIDUint,
+	}
+	err = cc.store.Comments().Create(ctx, &comment)
+	if errors.Is(err, model.ErrParentNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, model.ErrParentDeleted) || errors.Is(err, model.ErrMaxDepth) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
-	if err := model.DB.Create(&comment).Error; err != nil {
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to create a comment"})
 		return
 	}
-	c.JSON(201, gin.H{"message": "Comment created successfully"})
+	notifyComment(c, *post, comment)
+	c.JSON(201, gin.H{"message": "Comment created successfully", "comment_id": comment.ID})
 }
 
 func (cc *CommentController) GetComment(c *gin.Context) {
+	// GET /post/:id/comment?format=flat&sort=oldest&limit=20&cursor=...&user_id=5&from=2025-01-01
+	// format=tree pages through top-level comments and nests all their replies
 	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(400, gin.H{"error": "Invalid post ID"})
 		return
 	}
-	var comments []model.Comment
-	if err := model.DB.Where("post_id = ?", postID).Find(&comments).Error; err != nil {
+	// Comments of a post that is not published yet are only shown to its author
+	ctx := c.Request.Context()
+	if _, err := cc.store.Posts().FindVisible(ctx, uint(postID), c.GetUint("user_id")); err != nil {
+		c.JSON(404, gin.H{"error": "Post not found"})
+		return
+	}
+	format := c.DefaultQuery("format", "flat")
+	if format != "flat" && format != "tree" {
+		c.JSON(400, gin.H{"error": "Invalid format, use flat or tree"})
+		return
+	}
+	page, err := parsePageRequest(c, "oldest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if format == "tree" && page.Sort == "thread" {
+		c.JSON(400, gin.H{"error": "Invalid sort, use oldest, newest or, for the flat format, thread"})
+		return
+	}
+
+	filter := repository.CommentFilter{PostID: uint(postID), TopLevel: format == "tree"}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 32)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	filter.From, filter.To, err = parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	comments, cursor, err := cc.store.Comments().List(ctx, filter, page)
+	if errors.Is(err, repository.ErrInvalidSort) {
+		c.JSON(400, gin.H{"error": "Invalid sort, use oldest, newest or, for the flat format, thread"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get comments"})
+		return
+	}
+	total, err := cc.store.Comments().Count(ctx, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get comments"})
+		return
+	}
+	next := encodeCursor(page, cursor)
+	for i := range comments {
+		hideDeletedAuthor(&comments[i])
+	}
+
+	if format == "flat" {
+		targets := make([]*model.Comment, 0, len(comments))
+		for i := range comments {
+			targets = append(targets, &comments[i])
+		}
+		if err := attachReactions(c, cc.store.Reactions(), targets); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to get comments"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"count":       len(comments),
+			"total":       total,
+			"next_cursor": next,
+			"comments":    comments,
+		})
+		return
+	}
+
+	tree, err := cc.buildCommentTree(ctx, uint(postID), comments)
+	if err == nil {
+		err = attachReactions(c, cc.store.Reactions(), flattenTree(tree, nil))
+	}
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to get comments"})
 		return
 	}
 	c.JSON(200, gin.H{
-		"count":    len(comments),
-		"comments": comments,
+		"count":       len(tree),
+		"total":       total,
+		"next_cursor": next,
+		"comments":    tree,
 	})
 }
+
+// hideDeletedAuthor drops the author of a "[deleted]" placeholder from responses
+func hideDeletedAuthor(comment *model.Comment) {
+	if comment.Deleted {
+		comment.UserID = 0
+	}
+}
+
+// buildCommentTree loads every reply below the given top-level comments and
+// nests them. Replies are ordered oldest first.
+func (cc *CommentController) buildCommentTree(ctx context.Context, postID uint, roots []model.Comment) ([]*CommentNode, error) {
+	tree := make([]*CommentNode, 0, len(roots))
+	nodes := make(map[uint]*CommentNode, len(roots))
+	rootIDs := make([]uint, 0, len(roots))
+	for _, root := range roots {
+		node := &CommentNode{Comment: root, Replies: []*CommentNode{}}
+		nodes[root.ID] = node
+		tree = append(tree, node)
+		rootIDs = append(rootIDs, root.ID)
+	}
+
+	replies, err := cc.store.Comments().FindReplies(ctx, postID, rootIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		hideDeletedAuthor(&reply)
+		parent, ok := nodes[*reply.ParentID]
+		if !ok {
+			continue
+		}
+		node := &CommentNode{Comment: reply, Replies: []*CommentNode{}}
+		nodes[reply.ID] = node
+		parent.Replies = append(parent.Replies, node)
+	}
+	return tree, nil
+}
+
+// flattenTree appends every comment in the tree to list, parents before replies
+func flattenTree(nodes []*CommentNode, list []*model.Comment) []*model.Comment {
+	for _, node := range nodes {
+		list = append(list, &node.Comment)
+		list = flattenTree(node.Replies, list)
+	}
+	return list
+}
+
+func (cc *CommentController) UpdateComment(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+	var req UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	comment, err := cc.store.Comments().FindByID(ctx, uint(commentID))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Comment not found"})
+		return
+	}
+	err = cc.store.Comments().Edit(ctx, comment, req.Content)
+	if errors.Is(err, model.ErrCommentDeleted) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Comment updated successfully", "comment": comment})
+}
+
+func (cc *CommentController) DeleteComment(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+	ctx := c.Request.Context()
+	comment, err := cc.store.Comments().FindByID(ctx, uint(commentID))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Comment not found"})
+		return
+	}
+	if err := cc.store.Comments().Delete(ctx, comment); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Comment deleted successfully"})
+}
+
+// IsOwner reports whether the user wrote the comment in the :id path parameter.
+// Routes use it with middleware.RequireOwnership.
+func (cc *CommentController) IsOwner(c *gin.Context, userID uint) (bool, error) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false, errors.New("Invalid comment ID")
+	}
+	comment, err := cc.store.Comments().FindByID(c.Request.Context(), uint(commentID))
+	if err != nil {
+		return false, err
+	}
+	return comment.UserID == userID, nil
+}
+
+// IsOwnerOrPostOwner reports whether the user wrote the comment in the :id path
+// parameter or owns the post it belongs to. Post owners may remove comments
+// under their posts but not edit them.
+func (cc *CommentController) IsOwnerOrPostOwner(c *gin.Context, userID uint) (bool, error) {
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false, errors.New("Invalid comment ID")
+	}
+	ctx := c.Request.Context()
+	comment, err := cc.store.Comments().FindByID(ctx, uint(commentID))
+	if err != nil {
+		return false, err
+	}
+	if comment.UserID == userID {
+		return true, nil
+	}
+	post, err := cc.store.Posts().FindByID(ctx, comment.PostID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return post.UserID == userID, nil
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fakeStore keeps posts and comments in memory. Repositories the tests do not
+// need are left nil and panic when used.
+type fakeStore struct {
+	repository.Store
+	posts    map[uint]*model.Post
+	comments []*model.Comment
+}
+
+func (s *fakeStore) Posts() repository.PostRepository         { return fakePosts{s: s} }
+func (s *fakeStore) Comments() repository.CommentRepository   { return fakeComments{s: s} }
+func (s *fakeStore) Reactions() repository.ReactionRepository { return fakeReactions{} }
+
+func (s *fakeStore) Transaction(ctx context.Context, fn func(repository.Store) error) error {
+	return fn(s)
+}
+
+type fakePosts struct {
+	repository.PostRepository
+	s *fakeStore
+}
+
+func (r fakePosts) FindByID(ctx context.Context, id uint) (*model.Post, error) {
+	if post, ok := r.s.posts[id]; ok {
+		return post, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r fakePosts) FindVisible(ctx context.Context, id, viewerID uint) (*model.Post, error) {
+	post, err := r.FindByID(ctx, id)
+	if err != nil || post.Status == model.PostPublished || post.UserID == viewerID {
+		return post, err
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeComments struct {
+	repository.CommentRepository
+	s *fakeStore
+}
+
+func (r fakeComments) FindByID(ctx context.Context, id uint) (*model.Comment, error) {
+	for _, comment := range r.s.comments {
+		if comment.ID == id {
+			copied := *comment
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r fakeComments) Edit(ctx context.Context, comment *model.Comment, content string) error {
+	if comment.Deleted {
+		return model.ErrCommentDeleted
+	}
+	comment.Content = content
+	return nil
+}
+
+func (r fakeComments) FindReplies(ctx context.Context, postID uint, rootIDs []uint) ([]model.Comment, error) {
+	var replies []model.Comment
+	for _, comment := range r.s.comments {
+		if comment.PostID == postID && comment.ParentID != nil {
+			replies = append(replies, *comment)
+		}
+	}
+	return replies, nil
+}
+
+func (r fakeComments) matching(filter repository.CommentFilter) []model.Comment {
+	var matches []model.Comment
+	for _, comment := range r.s.comments {
+		if comment.PostID != filter.PostID || (filter.TopLevel && comment.ParentID != nil) ||
+			(filter.UserID != 0 && comment.UserID != filter.UserID) {
+			continue
+		}
+		matches = append(matches, *comment)
+	}
+	return matches
+}
+
+// List supports the oldest sort only, by id
+func (r fakeComments) List(ctx context.Context, filter repository.CommentFilter, page repository.Page) ([]model.Comment, *repository.Cursor, error) {
+	if page.Sort != "oldest" {
+		return nil, nil, repository.ErrInvalidSort
+	}
+	var rows []model.Comment
+	for _, comment := range r.matching(filter) {
+		if page.After == nil || comment.ID > page.After.ID {
+			rows = append(rows, comment)
+		}
+	}
+	if len(rows) <= page.Limit {
+		return rows, nil, nil
+	}
+	rows = rows[:page.Limit]
+	return rows, &repository.Cursor{ID: rows[len(rows)-1].ID}, nil
+}
+
+func (r fakeComments) Count(ctx context.Context, filter repository.CommentFilter) (int64, error) {
+	return int64(len(r.matching(filter))), nil
+}
+
+type fakeReactions struct{}
+
+func (fakeReactions) Summarize(ctx context.Context, targetType string, targetIDs []uint, viewerID uint) (map[uint]model.ReactionSummary, error) {
+	return map[uint]model.ReactionSummary{}, nil
+}
+
+func newFakeStore() *fakeStore {
+	reply := func(id, parentID, userID uint) *model.Comment {
+		return &model.Comment{Model: gorm.Model{ID: id}, PostID: 1, UserID: userID, ParentID: &parentID, Depth: 1, Content: "reply"}
+	}
+	return &fakeStore{
+		posts: map[uint]*model.Post{
+			1: {Model: gorm.Model{ID: 1}, UserID: 1, Status: model.PostPublished},
+			2: {Model: gorm.Model{ID: 2}, UserID: 1, Status: model.PostDraft},
+		},
+		comments: []*model.Comment{
+			{Model: gorm.Model{ID: 1}, PostID: 1, UserID: 2, Content: "first"},
+			reply(2, 1, 3),
+			{Model: gorm.Model{ID: 3}, PostID: 1, UserID: 3, Content: "[deleted]", Deleted: true},
+			{Model: gorm.Model{ID: 4}, PostID: 1, UserID: 2, Content: "last"},
+		},
+	}
+}
+
+// serve runs one request through a router with the comment routes, as the
+// user with userID when it is not 0
+func serve(cc *CommentController, userID uint, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if userID != 0 {
+			c.Set("user_id", userID)
+		}
+	})
+	r.GET("/post/:id/comment", cc.GetComment)
+	r.PUT("/comment/:id", cc.UpdateComment)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+type commentList struct {
+	Count      int    `json:"count"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor"`
+	Comments   []struct {
+		ID      uint `json:"ID"`
+		UserID  uint `json:"user_id"`
+		Replies []struct {
+			ID uint `json:"ID"`
+		} `json:"replies"`
+	} `json:"comments"`
+}
+
+func TestGetCommentTreePages(t *testing.T) {
+	cc := NewCommentController(newFakeStore())
+
+	w := serve(cc, 0, "GET", "/post/1/comment?format=tree&limit=2", "")
+	if w.Code != 200 {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var first commentList
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Count != 2 || first.Total != 3 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want 2 of 3 top-level comments and a cursor", first)
+	}
+	if len(first.Comments[0].Replies) != 1 || first.Comments[0].Replies[0].ID != 2 {
+		t.Errorf("comment 1 replies = %+v, want comment 2", first.Comments[0].Replies)
+	}
+	if first.Comments[1].ID != 3 || first.Comments[1].UserID != 0 {
+		t.Errorf("second comment = %+v, want the deleted comment 3 without its author", first.Comments[1])
+	}
+
+	w = serve(cc, 0, "GET", "/post/1/comment?format=tree&limit=2&cursor="+first.NextCursor, "")
+	var second commentList
+	if err := json.Unmarshal(w.Body.Bytes(), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second.Count != 1 || second.Comments[0].ID != 4 || second.NextCursor != "" {
+		t.Errorf("second page = %+v, want comment 4 and no cursor", second)
+	}
+}
+
+func TestGetCommentRejectsBadRequests(t *testing.T) {
+	cc := NewCommentController(newFakeStore())
+	tests := []struct {
+		name     string
+		userID   uint
+		target   string
+		wantCode int
+	}{
+		{"unknown post", 0, "/post/9/comment", http.StatusNotFound},
+		{"draft of another user", 2, "/post/2/comment", http.StatusNotFound},
+		{"own draft", 1, "/post/2/comment", http.StatusOK},
+		{"unknown format", 0, "/post/1/comment?format=list", http.StatusBadRequest},
+		{"thread sort in a tree", 0, "/post/1/comment?format=tree&sort=thread", http.StatusBadRequest},
+		{"sort the store does not know", 0, "/post/1/comment?sort=best", http.StatusBadRequest},
+		{"garbled cursor", 0, "/post/1/comment?cursor=!!!", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(cc, tt.userID, "GET", tt.target, ""); w.Code != tt.wantCode {
+				t.Errorf("GET %s status = %d, want %d, body %s", tt.target, w.Code, tt.wantCode, w.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateDeletedComment(t *testing.T) {
+	cc := NewCommentController(newFakeStore())
+	if w := serve(cc, 3, "PUT", "/comment/3", `{"content":"back"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("editing a deleted comment: status = %d, want 400", w.Code)
+	}
+	if w := serve(cc, 2, "PUT", "/comment/1", `{"content":"edited"}`); w.Code != http.StatusOK {
+		t.Errorf("editing a comment: status = %d, want 200, body %s", w.Code, w.Body)
+	}
+	if w := serve(cc, 2, "PUT", "/comment/9", `{"content":"edited"}`); w.Code != http.StatusNotFound {
+		t.Errorf("editing an unknown comment: status = %d, want 404", w.Code)
+	}
+}
+
+func TestIsOwnerOrPostOwner(t *testing.T) {
+	cc := NewCommentController(newFakeStore())
+	tests := []struct {
+		userID uint
+		want   bool
+	}{
+		{2, true},  // wrote the comment
+		{1, true},  // owns the post
+		{3, false}, // replied to it
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("DELETE", "/comment/1", nil)
+		c.Params = gin.Params{{Key: "id", Value: "1"}}
+		got, err := cc.IsOwnerOrPostOwner(c, tt.userID)
+		if err != nil || got != tt.want {
+			t.Errorf("IsOwnerOrPostOwner(user %d) = %v, %v, want %v", tt.userID, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"personalBloger/feed"
+	"personalBloger/model"
+	"personalBloger/render"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FeedController struct{}
+
+// summaryLength is the length of entry summaries, in characters
+const summaryLength = 300
+
+func (fc *FeedController) SiteRSS(c *gin.Context) {
+	writeFeed(c, "rss", nil)
+}
+
+func (fc *FeedController) SiteAtom(c *gin.Context) {
+	writeFeed(c, "atom", nil)
+}
+
+func (fc *FeedController) UserRSS(c *gin.Context) {
+	if author, ok := findFeedAuthor(c); ok {
+		writeFeed(c, "rss", author)
+	}
+}
+
+func (fc *FeedController) UserAtom(c *gin.Context) {
+	if author, ok := findFeedAuthor(c); ok {
+		writeFeed(c, "atom", author)
+	}
+}
+
+// findFeedAuthor loads the user in the :id path parameter
+func findFeedAuthor(c *gin.Context) (*model.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	var user model.User
+	if err := model.DB.Select("id", "username").Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// baseURL is the configured public address, or the address the request was sent to
+func baseURL(c *gin.Context) string {
+	if base := feed.Current().BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// writeFeed responds with the latest published posts, of one author or of the
+// whole site, as RSS or Atom. Unchanged feeds are answered with 304 Not Modified.
+func writeFeed(c *gin.Context, format string, author *model.User) {
+	settings := feed.Current()
+	base := baseURL(c)
+
+	// Only published posts, whoever asks
+	query := model.VisiblePosts(model.DB.Model(&model.Post{}), 0)
+	if author != nil {
+		query = query.Where("posts.user_id = ?", author.ID)
+	}
+	var posts []model.Post
+	err := query.Preload("Tags").
+		Order("posts.publish_at DESC, posts.id DESC").
+		Limit(settings.Limit).
+		Find(&posts).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get posts"})
+		return
+	}
+
+	// The feed only changes when one of its posts does, so the validators are
+	// derived from the posts before any Markdown is rendered
+	var updated time.Time
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%s|%s|", format, settings.Content, settings.Title, base)
+	for _, post := range posts {
+		fmt.Fprintf(hash, "%d:%d;", post.ID, post.UpdatedAt.UnixNano())
+		if post.UpdatedAt.After(updated) {
+			updated = post.UpdatedAt
+		}
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=300")
+	if !updated.IsZero() {
+		c.Header("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c, etag, updated) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	authors, err := authorNames(posts)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get posts"})
+		return
+	}
+	f := feed.Feed{
+		ID:          base + c.Request.URL.Path,
+		Title:       settings.Title,
+		Description: settings.Description,
+		Link:        base + "/v1/postlist",
+		SelfLink:    base + c.Request.URL.Path,
+		Updated:     updated,
+	}
+	if author != nil {
+		f.Title = settings.Title + ": posts by " + author.Username
+		f.Description = "The latest posts by " + author.Username
+		f.Link = fmt.Sprintf("%s/v1/postlist?user_id=%d", base, author.ID)
+		f.Author = author.Username
+	}
+	if f.Updated.IsZero() {
+		f.Updated = time.Now()
+	}
+	for _, post := range posts {
+		doc, err := render.Markdown(post.Content)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to render post"})
+			return
+		}
+		link := fmt.Sprintf("%s/v1/post/%d", base, post.ID)
+		item := feed.Item{
+			ID:      link,
+			Title:   post.Title,
+			Link:    link,
+			Author:  authors[post.UserID],
+			Updated: post.UpdatedAt,
+			Summary: doc.Summary(summaryLength),
+		}
+		item.Published = post.CreatedAt
+		if post.PublishAt != nil {
+			item.Published = *post.PublishAt
+		}
+		for _, tag := range post.Tags {
+			item.Categories = append(item.Categories, tag.Name)
+		}
+		if settings.Content == feed.ContentFull {
+			item.Content = doc.HTML
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	var body []byte
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		body, err = f.Atom()
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		body, err = f.RSS()
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to build feed"})
+		return
+	}
+	c.Data(200, contentType, body)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no ETag was sent
+func notModified(c *gin.Context, etag string, updated time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since := c.GetHeader("If-Modified-Since"); since != "" && !updated.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !updated.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// authorNames maps the authors of the posts to their usernames
+func authorNames(posts []model.Post) (map[uint]string, error) {
+	ids := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.UserID)
+	}
+	names := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	var users []model.User
+	if err := model.DB.Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names, nil
+}
@@ -0,0 +1,340 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"personalBloger/media"
+	"personalBloger/model"
+	"personalBloger/rbac"
+	"personalBloger/repository"
+	"personalBloger/storage"
+	"personalBloger/token"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MediaController struct{}
+
+// MediaItem is a media row with the URLs its file and thumbnail are served from
+type MediaItem struct {
+	model.Media
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func newMediaItem(m model.Media) MediaItem {
+	item := MediaItem{Media: m, URL: fmt.Sprintf("/v1/media/%d/file", m.ID)}
+	if m.ThumbnailKey != "" {
+		item.ThumbnailURL = fmt.Sprintf("/v1/media/%d/thumbnail", m.ID)
+	}
+	return item
+}
+
+// multipartOverhead leaves room for the multipart headers around the file
+const multipartOverhead = 64 << 10
+
+func (mc *MediaController) Upload(c *gin.Context) {
+	// POST /media takes a multipart form with a "file" field and an optional
+	// "post_id" to attach the file to one of the caller's posts
+	userID := c.GetUint("user_id")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, media.MaxSize+multipartOverhead)
+	file, header, err := c.Request.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("File is too large, the limit is %d MB", media.MaxSize>>20)})
+		return
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxSize+1))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if len(data) > media.MaxSize {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("File is too large, the limit is %d MB", media.MaxSize>>20)})
+		return
+	}
+	contentType, ext, ok := media.DetectType(data)
+	if !ok {
+		c.JSON(415, gin.H{"error": "Unsupported file type, use JPEG, PNG, GIF, WebP or PDF"})
+		return
+	}
+
+	item := model.Media{
+		UserID:      userID,
+		Filename:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	}
+	if postID := c.PostForm("post_id"); postID != "" {
+		id, err := strconv.ParseUint(postID, 10, 32)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid post ID"})
+			return
+		}
+		var post model.Post
+		if err := model.DB.Select("id", "user_id").Where("id = ?", id).First(&post).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Post not found"})
+			return
+		}
+		// Attaching counts as editing the post
+		role, _ := c.Get("role")
+		if r, _ := role.(rbac.Role); post.UserID != userID && !r.Can(rbac.PostUpdateAny) {
+			c.JSON(403, gin.H{"error": "You can only attach media to your own post"})
+			return
+		}
+		item.PostID = &post.ID
+	}
+
+	var thumb *media.Thumbnail
+	if media.IsImage(contentType) {
+		item.Width, item.Height, err = media.ImageSize(data)
+		if err == nil {
+			thumb, err = media.MakeThumbnail(data, contentType)
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": imageError(err)})
+			return
+		}
+	}
+
+	// Keys are random so they cannot be guessed or collide
+	base := time.Now().UTC().Format("2006/01/") + token.RandomString(16)
+	item.Key = base + ext
+	store := storage.Default()
+	ctx := c.Request.Context()
+	if err := store.Put(ctx, item.Key, bytes.NewReader(data), item.Size, contentType); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to store file"})
+		return
+	}
+	if thumb != nil {
+		item.ThumbnailKey = base + "_thumb" + thumb.Ext
+		if err := store.Put(ctx, item.ThumbnailKey, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType); err != nil {
+			store.Delete(ctx, item.Key)
+			c.JSON(500, gin.H{"error": "Failed to store file"})
+			return
+		}
+	}
+	if err := model.DB.Create(&item).Error; err != nil {
+		deleteMediaFiles(c, item)
+		c.JSON(500, gin.H{"error": "Failed to save media"})
+		return
+	}
+	c.JSON(201, gin.H{"message": "Media uploaded successfully", "media": newMediaItem(item)})
+}
+
+// imageError describes why an image could not be processed
+func imageError(err error) string {
+	if errors.Is(err, media.ErrTooManyPixels) {
+		return err.Error()
+	}
+	return "Invalid image"
+}
+
+// deleteMediaFiles removes the file and thumbnail of m from storage
+func deleteMediaFiles(c *gin.Context, m model.Media) error {
+	store := storage.Default()
+	if err := store.Delete(c.Request.Context(), m.Key); err != nil {
+		return err
+	}
+	if m.ThumbnailKey != "" {
+		return store.Delete(c.Request.Context(), m.ThumbnailKey)
+	}
+	return nil
+}
+
+// findVisibleMedia loads the media in the :id path parameter. Media attached
+// to a post the caller may not see is treated as missing.
+func findVisibleMedia(c *gin.Context) (*model.Media, bool) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid media ID"})
+		return nil, false
+	}
+	var item model.Media
+	if err := model.DB.Where("id = ?", mediaID).First(&item).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Media not found"})
+		return nil, false
+	}
+	if item.PostID != nil {
+		var post model.Post
+		err := model.VisiblePosts(model.DB, c.GetUint("user_id")).Select("id").Where("id = ?", *item.PostID).First(&post).Error
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Media not found"})
+			return nil, false
+		}
+	}
+	return &item, true
+}
+
+// cacheControl allows shared caches to keep media for good only when anyone
+// may see it: media on a draft or scheduled post must not outlive the
+// author's session in a proxy or browser cache.
+func cacheControl(item *model.Media) string {
+	if item.PostID != nil {
+		var post model.Post
+		err := model.VisiblePosts(model.DB, 0).Select("id").Where("id = ?", *item.PostID).First(&post).Error
+		if err != nil {
+			return "private, no-store"
+		}
+	}
+	return "public, max-age=31536000, immutable"
+}
+
+func (mc *MediaController) GetMedia(c *gin.Context) {
+	item, ok := findVisibleMedia(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{"media": newMediaItem(*item)})
+}
+
+func (mc *MediaController) GetFile(c *gin.Context) {
+	item, ok := findVisibleMedia(c)
+	if !ok {
+		return
+	}
+	serveObject(c, item.Key, item.ContentType, item.Filename, cacheControl(item))
+}
+
+func (mc *MediaController) GetThumbnail(c *gin.Context) {
+	item, ok := findVisibleMedia(c)
+	if !ok {
+		return
+	}
+	if item.ThumbnailKey == "" {
+		c.JSON(404, gin.H{"error": "Media has no thumbnail"})
+		return
+	}
+	contentType := "image/png"
+	if strings.HasSuffix(item.ThumbnailKey, ".jpg") {
+		contentType = "image/jpeg"
+	}
+	serveObject(c, item.ThumbnailKey, contentType, "", cacheControl(item))
+}
+
+// serveObject streams an object from storage with the given Cache-Control.
+// Objects never change once stored, so public ones may be cached for good.
+func serveObject(c *gin.Context, key, contentType, filename, cache string) {
+	body, err := storage.Default().Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", cache)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if filename != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	}
+	c.DataFromReader(200, -1, contentType, body, nil)
+}
+
+var mediaSorts = map[string]repository.Sort[model.Media]{
+	"oldest": repository.TimeSort("media.created_at", false, func(m model.Media) time.Time { return m.CreatedAt }),
+	"newest": repository.TimeSort("media.created_at", true, func(m model.Media) time.Time { return m.CreatedAt }),
+}
+
+func (mc *MediaController) GetPostMedia(c *gin.Context) {
+	// GET /post/:id/media?sort=oldest&limit=20&cursor=...
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	var post model.Post
+	if err := model.VisiblePosts(model.DB, c.GetUint("user_id")).Select("id").Where("id = ?", postID).First(&post).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Post not found"})
+		return
+	}
+	page, err := parsePageRequest(c, "oldest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	sort, ok := mediaSorts[page.Sort]
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid sort, use oldest or newest"})
+		return
+	}
+
+	query := model.DB.Model(&model.Media{}).Where("media.post_id = ?", postID)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get media"})
+		return
+	}
+	rows, next, err := paginate(query, page, sort, "media.id", func(m model.Media) uint { return m.ID })
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get media"})
+		return
+	}
+	items := make([]MediaItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, newMediaItem(row))
+	}
+	c.JSON(200, gin.H{
+		"count":       len(items),
+		"total":       total,
+		"next_cursor": next,
+		"media":       items,
+	})
+}
+
+func (mc *MediaController) DeleteMedia(c *gin.Context) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid media ID"})
+		return
+	}
+	var item model.Media
+	if err := model.DB.Where("id = ?", mediaID).First(&item).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Media not found"})
+		return
+	}
+	if err := model.DB.Delete(&item).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete media"})
+		return
+	}
+	// The row is gone, so a file left behind by a storage error is only an orphan
+	if err := deleteMediaFiles(c, item); err != nil {
+		c.Error(err)
+	}
+	c.JSON(200, gin.H{"message": "Media deleted successfully"})
+}
+
+// IsOwner reports whether the user uploaded the media in the :id path parameter.
+// Routes use it with middleware.RequireOwnership.
+func (mc *MediaController) IsOwner(c *gin.Context, userID uint) (bool, error) {
+	mediaID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false, errors.New("Invalid media ID")
+	}
+	var item model.Media
+	if err := model.DB.Select("id", "user_id").Where("id = ?", mediaID).First(&item).Error; err != nil {
+		return false, err
+	}
+	return item.UserID == userID, nil
+}
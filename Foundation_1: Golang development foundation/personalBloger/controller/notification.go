@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"personalBloger/model"
+	"personalBloger/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type NotificationController struct{}
+
+// UpdatePreferencesRequest switches notification types on (true) or off (false).
+// Types that are left out keep their current setting.
+type UpdatePreferencesRequest struct {
+	Enabled map[string]bool `json:"enabled" binding:"required"`
+}
+
+var notificationSorts = map[string]repository.Sort[model.Notification]{
+	"newest": repository.TimeSort("notifications.created_at", true, func(n model.Notification) time.Time { return n.CreatedAt }),
+	"oldest": repository.TimeSort("notifications.created_at", false, func(n model.Notification) time.Time { return n.CreatedAt }),
+}
+
+func (nc *NotificationController) GetNotifications(c *gin.Context) {
+	// GET /notifications?unread=true&sort=newest&limit=20&cursor=...
+	page, err := parsePageRequest(c, "newest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	sort, ok := notificationSorts[page.Sort]
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid sort, use newest or oldest"})
+		return
+	}
+
+	query := model.DB.Model(&model.Notification{}).
+		Where("notifications.user_id = ?", c.GetUint("user_id"))
+	if unread := c.Query("unread"); unread != "" {
+		onlyUnread, err := strconv.ParseBool(unread)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid unread, use true or false"})
+			return
+		}
+		if onlyUnread {
+			query = query.Where("notifications.read_at IS NULL")
+		}
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	query = query.Select("notifications.*, users.username AS actor_username").
+		Joins("LEFT JOIN users ON users.id = notifications.actor_id")
+	notifications, next, err := paginate(query, page, sort, "notifications.id", func(n model.Notification) uint { return n.ID })
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"count":         len(notifications),
+		"total":         total,
+		"next_cursor":   next,
+		"notifications": notifications,
+	})
+}
+
+func (nc *NotificationController) GetUnreadCount(c *gin.Context) {
+	// GET /notifications/unread_count is cheap enough to poll
+	var unread int64
+	err := model.DB.Model(&model.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", c.GetUint("user_id")).
+		Count(&unread).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	c.JSON(200, gin.H{"unread": unread})
+}
+
+func (nc *NotificationController) MarkRead(c *gin.Context) {
+	// PUT /notifications/:id/read keeps the first read time when repeated
+	notificationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+	var notification model.Notification
+	err = model.DB.Where("id = ? AND user_id = ?", notificationID, c.GetUint("user_id")).First(&notification).Error
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Notification not found"})
+		return
+	}
+	if notification.ReadAt == nil {
+		if err := model.DB.Model(&notification).Update("read_at", time.Now()).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to mark notification as read"})
+			return
+		}
+	}
+	c.JSON(200, gin.H{"message": "Notification marked as read"})
+}
+
+func (nc *NotificationController) MarkAllRead(c *gin.Context) {
+	// PUT /notifications/read_all
+	result := model.DB.Model(&model.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", c.GetUint("user_id")).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "All notifications marked as read", "updated": result.RowsAffected})
+}
+
+func (nc *NotificationController) GetPreferences(c *gin.Context) {
+	// GET /notifications/preferences
+	enabled, err := notificationPreferences(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notification preferences"})
+		return
+	}
+	c.JSON(200, gin.H{"enabled": enabled})
+}
+
+func (nc *NotificationController) UpdatePreferences(c *gin.Context) {
+	// PUT /notifications/preferences {"enabled": {"reaction": false}}
+	var req UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	for notificationType := range req.Enabled {
+		if !model.ValidNotificationType(notificationType) {
+			c.JSON(400, gin.H{"error": "Invalid notification type, use " + strings.Join(model.NotificationTypes, ", ")})
+			return
+		}
+	}
+	userID := c.GetUint("user_id")
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		for notificationType, on := range req.Enabled {
+			if err := model.SetNotificationMuted(tx, userID, notificationType, !on); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	enabled, err := notificationPreferences(userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notification preferences"})
+		return
+	}
+	c.JSON(200, gin.H{"enabled": enabled})
+}
+
+// notificationPreferences maps every notification type to whether the user receives it
+func notificationPreferences(userID uint) (map[string]bool, error) {
+	muted, err := model.MutedNotificationTypes(model.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(model.NotificationTypes))
+	for _, notificationType := range model.NotificationTypes {
+		enabled[notificationType] = true
+	}
+	for _, notificationType := range muted {
+		enabled[notificationType] = false
+	}
+	return enabled, nil
+}
+
+// notify stores a notification as a side effect of another action. The action
+// has already succeeded, so a failure is recorded on the context and not returned.
+func notify(c *gin.Context, n model.Notification) {
+	if err := model.Notify(model.DB, &n); err != nil {
+		c.Error(err)
+	}
+}
+
+// notifyComment tells the post author about a new comment and, for a reply,
+// the author of the parent comment. Nobody is told twice about one comment.
+func notifyComment(c *gin.Context, post model.Post, comment model.Comment) {
+	postID, commentID := comment.PostID, comment.ID
+	notified := uint(0)
+	if comment.ParentID != nil {
+		var parent model.Comment
+		if err := model.DB.Select("user_id").Where("id = ?", *comment.ParentID).First(&parent).Error; err != nil {
+			c.Error(err)
+		} else {
+			notify(c, model.Notification{UserID: parent.UserID, ActorID: comment.UserID, Type: model.NotifyReply, PostID: &postID, CommentID: &commentID})
+			notified = parent.UserID
+		}
+	}
+	if post.UserID != notified {
+		notify(c, model.Notification{UserID: post.UserID, ActorID: comment.UserID, Type: model.NotifyComment, PostID: &postID, CommentID: &commentID})
+	}
+}
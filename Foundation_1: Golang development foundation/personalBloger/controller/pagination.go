@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"personalBloger/repository"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageCursor is the position after the last row of a page, with the sort it
+// belongs to. It is handed to clients as opaque base64.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// parsePageRequest reads the limit, sort and cursor query parameters
+func parsePageRequest(c *gin.Context, defaultSort string) (repository.Page, error) {
+	page := repository.Page{Limit: defaultPageLimit, Sort: c.DefaultQuery("sort", defaultSort)}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, errors.New("Invalid limit")
+		}
+		page.Limit = min(n, maxPageLimit)
+	}
+	if encoded := c.Query("cursor"); encoded != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return page, repository.ErrInvalidCursor
+		}
+		var cur pageCursor
+		if err := json.Unmarshal(raw, &cur); err != nil {
+			return page, repository.ErrInvalidCursor
+		}
+		if cur.Sort != page.Sort {
+			return page, errors.New("Cursor does not match the requested sort")
+		}
+		page.After = &repository.Cursor{Value: cur.Value, ID: cur.ID}
+	}
+	return page, nil
+}
+
+// encodeCursor turns the cursor of the next page into the next_cursor of a
+// response, "" on the last page
+func encodeCursor(page repository.Page, next *repository.Cursor) string {
+	if next == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(pageCursor{Sort: page.Sort, Value: next.Value, ID: next.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// parseTimeFilter accepts either an RFC 3339 timestamp or a plain date
+func parseTimeFilter(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// parseDateRange reads the from and to query parameters. A plain "to" date
+// includes the whole day.
+func parseDateRange(c *gin.Context) (from, to *time.Time, err error) {
+	if value := c.Query("from"); value != "" {
+		t, err := parseTimeFilter(value)
+		if err != nil {
+			return nil, nil, errors.New("Invalid from date")
+		}
+		from = &t
+	}
+	if value := c.Query("to"); value != "" {
+		t, err := parseTimeFilter(value)
+		if err != nil {
+			return nil, nil, errors.New("Invalid to date")
+		}
+		if len(value) == len(time.DateOnly) {
+			t = t.Add(24 * time.Hour)
+		}
+		to = &t
+	}
+	return from, to, nil
+}
+
+// paginate runs the query for one page and returns the rows and the cursor of
+// the next page ("" on the last page). idColumn is the qualified primary key,
+// e.g. "posts.id".
+func paginate[T any](query *gorm.DB, page repository.Page, sort repository.Sort[T], idColumn string, idOf func(T) uint) ([]T, string, error) {
+	rows, next, err := repository.Paginate(query, page, sort, idColumn, idOf)
+	if err != nil {
+		return nil, "", err
+	}
+	return rows, encodeCursor(page, next), nil
+}
@@ -1,22 +1,53 @@
 package controller
 
 import (
+	"errors"
 	"personalBloger/model"
+	"personalBloger/render"
+	"personalBloger/repository"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type PostController struct{}
+type PostController struct {
+	store repository.Store
+}
+
+// NewPostController returns a PostController that works on store
+func NewPostController(store repository.Store) *PostController {
+	return &PostController{store: store}
+}
 
 type CreatePostRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Title   string   `json:"title" binding:"required"`
+	Content string   `json:"content" binding:"required"`
+	Tags    []string `json:"tags" binding:"max=10,dive,required,max=30"`
+	// Status defaults to published; scheduled posts need PublishAt
+	Status    string     `json:"status" binding:"omitempty,oneof=draft published scheduled archived"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type UpdatePostRequest struct {
 	Title   string `json:"title" binding:"required"`
 	Content string `json:"content" binding:"required"`
+	// Tags replaces the post's tags when present and leaves them alone when omitted
+	Tags *[]string `json:"tags" binding:"omitempty,max=10,dive,required,max=30"`
+	// Status and PublishAt leave the status alone when omitted
+	Status    string     `json:"status" binding:"omitempty,oneof=draft published scheduled archived"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// PostDetail is a single post with its Markdown content rendered to sanitized HTML
+type PostDetail struct {
+	model.Post
+	ContentHTML string           `json:"content_html"`
+	TOC         []render.Heading `json:"toc"`
+	WordCount   int              `json:"word_count"`
+	ReadingTime int              `json:"reading_time_minutes"`
+	// Reactions includes the caller's own reactions when they sent a token
+	Reactions model.ReactionSummary `json:"reactions"`
 }
 
 func (pc *PostController) CreatePost(c *gin.Context) {
@@ -51,7 +82,25 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 		Content: req.Content,
 		UserID:  userIDUint,
 	}
-	if err := model.DB.Create(&post).Error; err != nil {
+	status := model.PostPublished
+	if req.Status != "" {
+		status = model.PostStatus(req.Status)
+	}
+	if err := post.SetStatus(status, req.PublishAt); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	err := pc.store.Transaction(ctx, func(s repository.Store) error {
+		if err := s.Posts().Create(ctx, &post); err != nil {
+			return err
+		}
+		if err := s.Posts().SetTags(ctx, &post, req.Tags); err != nil {
+			return err
+		}
+		return s.Posts().RecordRevision(ctx, &post, userIDUint)
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to create a post"})
 		return
 	}
@@ -59,23 +108,70 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 }
 
 func (pc *PostController) GetPostList(c *gin.Context) {
-	// Get user_id from query parameter: GET /postlist?user_id=5
-	userID := c.Query("user_id")
+	// GET /postlist?user_id=5&tag=go&status=draft&sort=newest&limit=20&cursor=...&from=2025-01-01&to=2025-12-31
+	// Without user_id this is the global feed
+	var filter repository.PostFilter
+	if tag := c.Query("tag"); tag != "" {
+		filter.Tag = model.TagSlug(tag)
+	}
+	listPosts(c, pc.store.Posts(), filter)
+}
 
-	if userID == "" {
-		c.JSON(400, gin.H{"error": "user_id is required"})
+// listPosts adds the common filters of the query parameters to filter and
+// writes the page of posts as the response. Posts the caller may not see are left out.
+func listPosts(c *gin.Context, posts repository.PostRepository, filter repository.PostFilter) {
+	page, err := parsePageRequest(c, "newest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 32)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	if status := c.Query("status"); status != "" {
+		if !model.ValidPostStatus(status) {
+			c.JSON(400, gin.H{"error": "Invalid status, use draft, published, scheduled or archived"})
+			return
+		}
+		filter.Status = model.PostStatus(status)
+	}
+	filter.ViewerID = c.GetUint("user_id")
+	filter.From, filter.To, err = parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	var posts []model.Post
-	if err := model.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&posts).Error; err != nil {
+	ctx := c.Request.Context()
+	list, next, err := posts.List(ctx, filter, page)
+	if errors.Is(err, repository.ErrInvalidSort) {
+		c.JSON(400, gin.H{"error": "Invalid sort, use newest, oldest or most_commented"})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get posts"})
+		return
+	}
+	total, err := posts.Count(ctx, filter)
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
 	c.JSON(200, gin.H{
-		"count": len(posts),
-		"posts": posts,
+		"count":       len(list),
+		"total":       total,
+		"next_cursor": encodeCursor(page, next),
+		"posts":       list,
 	})
 }
 
@@ -85,13 +181,31 @@ func (pc *PostController) GetPost(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "Invalid post ID"})
 		return
 	}
-	var post model.Post
-	if err := model.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+	// Posts that are not published yet are only shown to their author
+	post, err := pc.store.Posts().FindVisible(c.Request.Context(), uint(postID), c.GetUint("user_id"))
+	if err != nil {
 		c.JSON(404, gin.H{"error": "Post not found"})
 		return
 	}
+	doc, err := render.Markdown(post.Content)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to render post"})
+		return
+	}
+	reactions, err := pc.store.Reactions().Summarize(c.Request.Context(), model.ReactionTargetPost, []uint{post.ID}, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get post"})
+		return
+	}
 	c.JSON(200, gin.H{
-		"post": post,
+		"post": PostDetail{
+			Post:        *post,
+			ContentHTML: doc.HTML,
+			TOC:         doc.TOC,
+			WordCount:   doc.WordCount,
+			ReadingTime: doc.ReadingTime,
+			Reactions:   reactions[post.ID],
+		},
 	})
 }
 
@@ -107,40 +221,43 @@ func (pc *PostController) UpdatePost(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	//check user_id
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(401, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	// JWT claims return float64 for numbers, need to convert to uint
-	var userIDUint uint
-	switch v := userID.(type) {
-	case float64:
-		userIDUint = uint(v)
-	case uint:
-		userIDUint = v
-	default:
-		c.JSON(500, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-
 	// check post_id
-	var post model.Post
-	if err := model.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+	ctx := c.Request.Context()
+	post, err := pc.store.Posts().FindByID(ctx, uint(postID))
+	if err != nil {
 		c.JSON(404, gin.H{"error": "Post not found"})
 		return
 	}
-	// check if the person is the owner of the post
-	if post.UserID != userIDUint {
-		c.JSON(403, gin.H{"error": "You can only update your own post"})
-		return
-	}
 	//update post
+	changed := post.Title != req.Title || post.Content != req.Content
 	post.Title = req.Title
 	post.Content = req.Content
-	if err := model.DB.Save(&post).Error; err != nil {
+	if req.Status != "" || req.PublishAt != nil {
+		status := post.Status
+		if req.Status != "" {
+			status = model.PostStatus(req.Status)
+		}
+		if err := post.SetStatus(status, req.PublishAt); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	err = pc.store.Transaction(ctx, func(s repository.Store) error {
+		if err := s.Posts().Save(ctx, post); err != nil {
+			return err
+		}
+		// Every change to the title or content is kept as a revision
+		if changed {
+			if err := s.Posts().RecordRevision(ctx, post, c.GetUint("user_id")); err != nil {
+				return err
+			}
+		}
+		if req.Tags == nil {
+			return nil
+		}
+		return s.Posts().SetTags(ctx, post, *req.Tags)
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to update post"})
 		return
 	}
@@ -153,41 +270,31 @@ func (pc *PostController) DeletePost(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "Invalid post ID"})
 		return
 	}
-	//check user_id
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(401, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	// JWT claims return float64 for numbers, need to convert to uint
-	var userIDUint uint
-	switch v := userID.(type) {
-	case float64:
-		userIDUint = uint(v)
-	case uint:
-		userIDUint = v
-	default:
-		c.JSON(500, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-
 	// check post_id
-	var post model.Post
-	if err := model.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+	ctx := c.Request.Context()
+	post, err := pc.store.Posts().FindByID(ctx, uint(postID))
+	if err != nil {
 		c.JSON(404, gin.H{"error": "Post not found"})
 		return
 	}
-
-	// check if the person is the owner of the post
-	if post.UserID != userIDUint {
-		c.JSON(403, gin.H{"error": "You can only delete your own post"})
-		return
-	}
 	//delete post
-	if err := model.DB.Delete(&post).Error; err != nil {
+	if err := pc.store.Posts().Delete(ctx, post); err != nil {
 		c.JSON(500, gin.H{"error": "Failed to delete post"})
 		return
 	}
 	c.JSON(200, gin.H{"message": "Post deleted successfully"})
 }
+
+// IsOwner reports whether the user wrote the post in the :id path parameter.
+// Routes use it with middleware.RequireOwnership.
+func (pc *PostController) IsOwner(c *gin.Context, userID uint) (bool, error) {
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false, errors.New("Invalid post ID")
+	}
+	post, err := pc.store.Posts().FindByID(c.Request.Context(), uint(postID))
+	if err != nil {
+		return false, err
+	}
+	return post.UserID == userID, nil
+}
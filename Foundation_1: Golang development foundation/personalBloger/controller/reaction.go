@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReactionController struct{}
+
+func (rc *ReactionController) AddPostReaction(c *gin.Context) {
+	react(c, model.ReactionTargetPost, true)
+}
+
+func (rc *ReactionController) RemovePostReaction(c *gin.Context) {
+	react(c, model.ReactionTargetPost, false)
+}
+
+func (rc *ReactionController) AddCommentReaction(c *gin.Context) {
+	react(c, model.ReactionTargetComment, true)
+}
+
+func (rc *ReactionController) RemoveCommentReaction(c *gin.Context) {
+	react(c, model.ReactionTargetComment, false)
+}
+
+// react adds or removes the caller's :type reaction on the post or comment in
+// the :id path parameter and responds with the target's updated summary.
+// Both directions are idempotent, so retries are safe.
+func react(c *gin.Context, targetType string, add bool) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid " + targetType + " ID"})
+		return
+	}
+	reactionType := c.Param("type")
+	if !model.ValidReactionType(reactionType) {
+		c.JSON(400, gin.H{"error": "Invalid reaction type, use " + strings.Join(model.ReactionTypes, ", ")})
+		return
+	}
+	userID := c.GetUint("user_id")
+	target, ok := findReactionTarget(c, targetType, uint(targetID), userID)
+	if !ok {
+		return
+	}
+
+	if add {
+		var created bool
+		created, err = model.AddReaction(model.DB, userID, targetType, uint(targetID), reactionType)
+		if err == nil && created {
+			notify(c, model.Notification{UserID: target.authorID, ActorID: userID, Type: model.NotifyReaction, PostID: &target.postID, CommentID: target.commentID})
+		}
+	} else {
+		err = model.RemoveReaction(model.DB, userID, targetType, uint(targetID), reactionType)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update reaction"})
+		return
+	}
+	summaries, err := model.SummarizeReactions(model.DB, targetType, []uint{uint(targetID)}, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get reactions"})
+		return
+	}
+	c.JSON(200, gin.H{"reactions": summaries[uint(targetID)]})
+}
+
+// reactionTarget is what a reaction notification points at
+type reactionTarget struct {
+	authorID  uint
+	postID    uint
+	commentID *uint
+}
+
+// findReactionTarget checks that the user can see the target, writing an error
+// response if not. Deleted comment placeholders cannot be reacted to.
+func findReactionTarget(c *gin.Context, targetType string, targetID, userID uint) (reactionTarget, bool) {
+	target := reactionTarget{postID: targetID}
+	if targetType == model.ReactionTargetComment {
+		var comment model.Comment
+		if err := model.DB.Select("id", "post_id", "user_id", "deleted").Where("id = ?", targetID).First(&comment).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Comment not found"})
+			return target, false
+		}
+		if comment.Deleted {
+			c.JSON(400, gin.H{"error": "Cannot react to a deleted comment"})
+			return target, false
+		}
+		target = reactionTarget{authorID: comment.UserID, postID: comment.PostID, commentID: &comment.ID}
+	}
+	var post model.Post
+	if err := model.VisiblePosts(model.DB, userID).Select("id", "user_id").Where("id = ?", target.postID).First(&post).Error; err != nil {
+		if targetType == model.ReactionTargetComment {
+			c.JSON(404, gin.H{"error": "Comment not found"})
+		} else {
+			c.JSON(404, gin.H{"error": "Post not found"})
+		}
+		return target, false
+	}
+	if target.commentID == nil {
+		target.authorID = post.UserID
+	}
+	return target, true
+}
+
+// attachReactions fills in the reaction summaries of the comments
+func attachReactions(c *gin.Context, reactions repository.ReactionRepository, comments []*model.Comment) error {
+	ids := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	summaries, err := reactions.Summarize(c.Request.Context(), model.ReactionTargetComment, ids, c.GetUint("user_id"))
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		summary := summaries[comment.ID]
+		comment.Reactions = &summary
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"personalBloger/render"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RenderController struct{}
+
+type PreviewRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+func (rc *RenderController) Preview(c *gin.Context) {
+	// POST /render/preview renders Markdown the same way GetPost does, without saving it
+	var req PreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	doc, err := render.Markdown(req.Content)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to render content"})
+		return
+	}
+	c.JSON(200, doc)
+}
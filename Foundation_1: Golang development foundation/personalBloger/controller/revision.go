@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"personalBloger/diff"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RevisionController struct{}
+
+var revisionSorts = map[string]repository.Sort[model.PostRevision]{
+	"newest": repository.CountSort("post_revisions.number", true, func(r model.PostRevision) int64 { return int64(r.Number) }),
+	"oldest": repository.CountSort("post_revisions.number", false, func(r model.PostRevision) int64 { return int64(r.Number) }),
+}
+
+// findRevision loads revision number of the post, writing a 404 if it does not exist
+func findRevision(c *gin.Context, postID uint64, number string) (*model.PostRevision, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid revision number"})
+		return nil, false
+	}
+	var revision model.PostRevision
+	if err := model.DB.Where("post_id = ? AND number = ?", postID, n).First(&revision).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Revision not found"})
+		return nil, false
+	}
+	return &revision, true
+}
+
+func (rc *RevisionController) GetRevisions(c *gin.Context) {
+	// GET /post/:id/revisions?sort=newest&limit=20&cursor=...
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	page, err := parsePageRequest(c, "newest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	sort, ok := revisionSorts[page.Sort]
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid sort, use newest or oldest"})
+		return
+	}
+
+	query := model.DB.Model(&model.PostRevision{}).Where("post_revisions.post_id = ?", postID)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get revisions"})
+		return
+	}
+	revisions, next, err := paginate(query, page, sort, "post_revisions.id", func(r model.PostRevision) uint { return r.ID })
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get revisions"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"count":       len(revisions),
+		"total":       total,
+		"next_cursor": next,
+		"revisions":   revisions,
+	})
+}
+
+func (rc *RevisionController) GetRevision(c *gin.Context) {
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	revision, ok := findRevision(c, postID, c.Param("number"))
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{"revision": revision})
+}
+
+func (rc *RevisionController) DiffRevisions(c *gin.Context) {
+	// GET /post/:id/revisions/diff?from=1&to=3
+	// to defaults to the latest revision and from to the one before it
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	to := c.Query("to")
+	if to == "" {
+		var latest int
+		err := model.DB.Model(&model.PostRevision{}).
+			Where("post_id = ?", postID).
+			Select("COALESCE(MAX(number), 0)").
+			Scan(&latest).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to get revisions"})
+			return
+		}
+		to = strconv.Itoa(latest)
+	}
+	toRevision, ok := findRevision(c, postID, to)
+	if !ok {
+		return
+	}
+	from := c.DefaultQuery("from", strconv.Itoa(max(toRevision.Number-1, 1)))
+	fromRevision, ok := findRevision(c, postID, from)
+	if !ok {
+		return
+	}
+
+	content, err := diff.Text(fromRevision.Content, toRevision.Content)
+	if errors.Is(err, diff.ErrTooLarge) {
+		c.JSON(422, gin.H{"error": fmt.Sprintf("The revisions are too long to compare, the limit is %d lines", diff.MaxLines)})
+		return
+	}
+	title, _ := diff.Text(fromRevision.Title, toRevision.Title)
+	c.JSON(200, gin.H{
+		"from":         fromRevision.Number,
+		"to":           toRevision.Number,
+		"title_diff":   title,
+		"content_diff": content,
+		"unified":      diff.Unified(content),
+	})
+}
+
+func (rc *RevisionController) RestoreRevision(c *gin.Context) {
+	// POST /post/:id/revisions/:number/restore copies an old revision back into
+	// the post and records it as a new revision
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	old, ok := findRevision(c, postID, c.Param("number"))
+	if !ok {
+		return
+	}
+	var post model.Post
+	if err := model.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var revision *model.PostRevision
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		post.Title = old.Title
+		post.Content = old.Content
+		err := tx.Model(&post).Updates(map[string]interface{}{
+			"title":   post.Title,
+			"content": post.Content,
+		}).Error
+		if err != nil {
+			return err
+		}
+		revision, err = model.RecordRevision(tx, &post, c.GetUint("user_id"), &old.Number)
+		return err
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Revision restored successfully", "revision": revision})
+}
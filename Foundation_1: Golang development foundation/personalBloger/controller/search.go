@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"errors"
+	"html"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SearchController struct{}
+
+// SearchResult is one ranked hit. Title and Snippet are HTML-escaped, with the
+// matching terms wrapped in <mark> tags.
+type SearchResult struct {
+	DocID     uint      `json:"-"`
+	Kind      string    `json:"type"`
+	RefID     uint      `json:"id"`
+	PostID    uint      `json:"post_id"`
+	PostTitle string    `json:"post_title"`
+	Title     string    `json:"title,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
+	CreatedAt time.Time `json:"created_at" gorm:"-"`
+
+	PostCreatedAt    time.Time  `json:"-"`
+	CommentCreatedAt *time.Time `json:"-"`
+}
+
+// createdAt is when the matching post or comment was written
+func (r SearchResult) createdAt() time.Time {
+	if r.CommentCreatedAt != nil {
+		return *r.CommentCreatedAt
+	}
+	return r.PostCreatedAt
+}
+
+// Snippets are marked with control characters and only turned into <mark> tags
+// after escaping, so the stored text can never inject HTML.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+var searchSorts = map[string]repository.Sort[SearchResult]{
+	// bm25 scores are negative, the best match has the lowest score
+	"relevance": repository.ScoreSort("results.rank", false, func(r SearchResult) float64 { return r.Rank }),
+	"newest":    repository.TimeSort("COALESCE(results.comment_created_at, results.post_created_at)", true, SearchResult.createdAt),
+}
+
+// buildMatchQuery turns free text into an FTS5 query that matches documents
+// containing every word. Words are quoted so FTS5 operators in the input are
+// treated as text; a trailing * is kept as a prefix search.
+func buildMatchQuery(q string) string {
+	var terms []string
+	for _, word := range strings.Fields(q) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markEnd, "</mark>")
+}
+
+func (sc *SearchController) Search(c *gin.Context) {
+	// GET /search?q=golang&type=post&sort=relevance&limit=20&cursor=...
+	if !model.SearchEnabled() {
+		c.JSON(503, gin.H{"error": "Search is not available"})
+		return
+	}
+	match := buildMatchQuery(c.Query("q"))
+	if match == "" {
+		c.JSON(400, gin.H{"error": "q is required"})
+		return
+	}
+	kind := c.Query("type")
+	if kind != "" && kind != model.SearchKindPost && kind != model.SearchKindComment {
+		c.JSON(400, gin.H{"error": "Invalid type, use post or comment"})
+		return
+	}
+	page, err := parsePageRequest(c, "relevance")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	sort, ok := searchSorts[page.Sort]
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid sort, use relevance or newest"})
+		return
+	}
+
+	// bm25() can only be used in the query that runs MATCH, so rank inside a
+	// subquery and paginate over its results
+	hits := model.DB.Table("search_index").
+		Select(`search_index.rowid AS doc_id, search_index.kind, search_index.ref_id, search_index.post_id,
+			posts.title AS post_title,
+			highlight(search_index, 0, ?, ?) AS title,
+			snippet(search_index, 1, ?, ?, '…', 24) AS snippet,
+			bm25(search_index, 5.0, 1.0) AS rank,
+			posts.created_at AS post_created_at, comments.created_at AS comment_created_at`,
+			markStart, markEnd, markStart, markEnd).
+		Joins("JOIN posts ON posts.id = search_index.post_id AND posts.deleted_at IS NULL").
+		Joins("LEFT JOIN comments ON search_index.kind = 'comment' AND comments.id = search_index.ref_id").
+		Where("search_index MATCH ?", match)
+	hits = model.VisiblePosts(hits, c.GetUint("user_id"))
+	if kind != "" {
+		hits = hits.Where("search_index.kind = ?", kind)
+	}
+	query := model.DB.Table("(?) AS results", hits)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to search"})
+		return
+	}
+	results, next, err := paginate(query, page, sort, "results.doc_id", func(r SearchResult) uint { return r.DocID })
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to search"})
+		return
+	}
+	for i := range results {
+		results[i].Title = highlight(results[i].Title)
+		results[i].Snippet = highlight(results[i].Snippet)
+		results[i].PostTitle = html.EscapeString(results[i].PostTitle)
+		results[i].CreatedAt = results[i].createdAt()
+	}
+
+	c.JSON(200, gin.H{
+		"count":       len(results),
+		"total":       total,
+		"next_cursor": next,
+		"results":     results,
+	})
+}
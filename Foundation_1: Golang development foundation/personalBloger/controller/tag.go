@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"personalBloger/model"
+	"personalBloger/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagController struct {
+	store repository.Store
+}
+
+// NewTagController returns a TagController that works on store
+func NewTagController(store repository.Store) *TagController {
+	return &TagController{store: store}
+}
+
+// TagSummary is a tag together with the number of published posts carrying it
+type TagSummary struct {
+	model.Tag
+	PostCount int64 `json:"post_count"`
+}
+
+func (tc *TagController) GetTags(c *gin.Context) {
+	// GET /tags lists every tag with the number of published posts carrying it
+	var tags []TagSummary
+	err := model.DB.Model(&model.Tag{}).
+		Select("tags.*, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL AND posts.status = ?", model.PostPublished).
+		Group("tags.id").
+		Order("post_count DESC, tags.name").
+		Find(&tags).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get tags"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"count": len(tags),
+		"tags":  tags,
+	})
+}
+
+func (tc *TagController) GetTagPosts(c *gin.Context) {
+	// GET /tags/:slug/posts accepts the same query parameters as /postlist
+	var tag model.Tag
+	if err := model.DB.Where("slug = ?", model.TagSlug(c.Param("slug"))).First(&tag).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Tag not found"})
+		return
+	}
+	listPosts(c, tc.store.Posts(), repository.PostFilter{Tag: tag.Slug})
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"errors"
+	"personalBloger/model"
+	"personalBloger/repository"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UserController struct {
+	store repository.Store
+}
+
+// NewUserController returns a UserController that works on store
+func NewUserController(store repository.Store) *UserController {
+	return &UserController{store: store}
+}
+
+// UserProfile is the public view of a user
+type UserProfile struct {
+	ID             uint      `json:"id"`
+	Username       string    `json:"username"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+	PostCount      int64     `json:"post_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+	// FollowedByMe tells a signed-in caller whether they follow this user
+	FollowedByMe bool `json:"followed_by_me"`
+}
+
+// FollowEntry is one user in a followers or following list
+type FollowEntry struct {
+	ID         uint      `json:"id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+var followSorts = map[string]repository.Sort[FollowEntry]{
+	"newest": repository.TimeSort("follows.created_at", true, func(f FollowEntry) time.Time { return f.FollowedAt }),
+	"oldest": repository.TimeSort("follows.created_at", false, func(f FollowEntry) time.Time { return f.FollowedAt }),
+}
+
+// findUser loads the user in the :id path parameter, writing a 404 if there is none
+func findUser(c *gin.Context) (*model.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	var user model.User
+	if err := model.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+func (uc *UserController) GetProfile(c *gin.Context) {
+	// GET /users/:id shows the public profile with follower counts
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	profile := UserProfile{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      string(user.Role),
+		CreatedAt: user.CreatedAt,
+	}
+	err := model.DB.Model(&model.Post{}).Where("user_id = ? AND status = ?", user.ID, model.PostPublished).Count(&profile.PostCount).Error
+	if err == nil {
+		err = model.DB.Model(&model.Follow{}).
+			Joins("JOIN users ON users.id = follows.follower_id AND users.deleted_at IS NULL").
+			Where("follows.followee_id = ?", user.ID).
+			Count(&profile.FollowerCount).Error
+	}
+	if err == nil {
+		err = model.DB.Model(&model.Follow{}).
+			Joins("JOIN users ON users.id = follows.followee_id AND users.deleted_at IS NULL").
+			Where("follows.follower_id = ?", user.ID).
+			Count(&profile.FollowingCount).Error
+	}
+	if viewer := c.GetUint("user_id"); err == nil && viewer != 0 {
+		var n int64
+		err = model.DB.Model(&model.Follow{}).Where("follower_id = ? AND followee_id = ?", viewer, user.ID).Count(&n).Error
+		profile.FollowedByMe = n > 0
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get profile"})
+		return
+	}
+	c.JSON(200, gin.H{"user": profile})
+}
+
+func (uc *UserController) GetFollowers(c *gin.Context) {
+	// GET /users/:id/followers?sort=newest&limit=20&cursor=...
+	listFollows(c, "follows.followee_id", "follows.follower_id", "followers")
+}
+
+func (uc *UserController) GetFollowing(c *gin.Context) {
+	// GET /users/:id/following?sort=newest&limit=20&cursor=...
+	listFollows(c, "follows.follower_id", "follows.followee_id", "following")
+}
+
+// listFollows pages through the users on the other side of the user's follows.
+// ownColumn holds the user in the path, otherColumn the users to list.
+func listFollows(c *gin.Context, ownColumn, otherColumn, key string) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	page, err := parsePageRequest(c, "newest")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	sort, ok := followSorts[page.Sort]
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid sort, use newest or oldest"})
+		return
+	}
+
+	query := model.DB.Model(&model.User{}).
+		Joins("JOIN follows ON users.id = "+otherColumn).
+		Where(ownColumn+" = ?", user.ID)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get " + key})
+		return
+	}
+	query = query.Select("users.id, users.username, follows.created_at AS followed_at")
+	entries, next, err := paginate(query, page, sort, "users.id", func(f FollowEntry) uint { return f.ID })
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get " + key})
+		return
+	}
+	c.JSON(200, gin.H{
+		"count":       len(entries),
+		"total":       total,
+		"next_cursor": next,
+		key:           entries,
+	})
+}
+
+func (uc *UserController) Follow(c *gin.Context) {
+	// PUT /users/:id/follow is idempotent
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+	created, err := model.FollowUser(model.DB, userID, user.ID)
+	if errors.Is(err, model.ErrFollowSelf) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to follow user"})
+		return
+	}
+	// Following again must not notify again
+	if created {
+		notify(c, model.Notification{UserID: user.ID, ActorID: userID, Type: model.NotifyFollow})
+	}
+	c.JSON(200, gin.H{"message": "You are now following " + user.Username})
+}
+
+func (uc *UserController) Unfollow(c *gin.Context) {
+	// DELETE /users/:id/follow is idempotent
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	if err := model.UnfollowUser(model.DB, c.GetUint("user_id"), user.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "You are no longer following " + user.Username})
+}
+
+func (uc *UserController) GetTimeline(c *gin.Context) {
+	// GET /feed merges the posts of everyone the caller follows. It accepts the
+	// same query parameters as /postlist.
+	listPosts(c, uc.store.Posts(), repository.PostFilter{FollowedBy: c.GetUint("user_id")})
+}
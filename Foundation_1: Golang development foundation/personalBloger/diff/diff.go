@@ -0,0 +1,235 @@
+// Package diff computes line-level differences between two texts using
+// Myers' O(ND) algorithm, which finds a shortest edit script, in linear space.
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// Op is the kind of change a line represents
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Line is one line of a diff. OldLine and NewLine are 1-based line numbers in
+// the old and new text; a line that only exists on one side has 0 for the other.
+type Line struct {
+	Op      Op     `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// SplitLines splits text into lines, accepting both \n and \r\n endings
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// MaxLines is the most lines Text diffs, counting both texts. The work grows
+// with the number of lines times the number of changes.
+const MaxLines = 10000
+
+// ErrTooLarge is returned by Text for texts with more than MaxLines lines
+var ErrTooLarge = errors.New("the texts are too long to compare")
+
+// Text diffs two texts line by line
+func Text(a, b string) ([]Line, error) {
+	linesA, linesB := SplitLines(a), SplitLines(b)
+	if len(linesA)+len(linesB) > MaxLines {
+		return nil, ErrTooLarge
+	}
+	return Lines(linesA, linesB), nil
+}
+
+// Lines returns the edit script that turns a into b. Deletions are listed
+// before insertions at the same position. It uses the linear space variant of
+// Myers' algorithm, which splits the texts at the middle of a shortest edit
+// script and diffs both halves.
+func Lines(a, b []string) []Line {
+	size := (len(a) + len(b) + 1) / 2
+	d := &differ{
+		a:     a,
+		b:     b,
+		lines: make([]Line, 0, max(len(a), len(b))),
+		fwd:   make([]int, 2*size+2),
+		rev:   make([]int, 2*size+2),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return deletesFirst(d.lines)
+}
+
+// differ holds the texts, the script built so far and the diagonals of the
+// forward and reverse search, which are reused by every split
+type differ struct {
+	a, b     []string
+	lines    []Line
+	fwd, rev []int
+}
+
+// compare appends the script for a[aLo:aHi] and b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	if x, y, ok := d.middle(aLo, aHi, bLo, bHi); ok {
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	} else {
+		// One side is empty or the ranges have nothing in common
+		for x := aLo; x < aHi; x++ {
+			d.lines = append(d.lines, Line{Op: Delete, Text: d.a[x], OldLine: x + 1})
+		}
+		for y := bLo; y < bHi; y++ {
+			d.lines = append(d.lines, Line{Op: Insert, Text: d.b[y], NewLine: y + 1})
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.equal(aHi+i, bHi+i)
+	}
+}
+
+func (d *differ) equal(x, y int) {
+	d.lines = append(d.lines, Line{Op: Equal, Text: d.a[x], OldLine: x + 1, NewLine: y + 1})
+}
+
+// middle runs the search from both ends of a[aLo:aHi] and b[bLo:bHi] until the
+// paths overlap and returns a point on a shortest edit script where they do.
+// The ranges differ in their first and last lines. It returns false when one
+// is empty or they have no line in common.
+func (d *differ) middle(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	// fwd[k+offset] is the furthest x reached on diagonal k from the start,
+	// rev[k+offset] the furthest x reached on diagonal k from the end
+	fwd, rev := d.fwd[:size], d.rev[:size]
+	for i := range fwd {
+		fwd[i], rev[i] = -1, -1
+	}
+	fwd[offset+1], rev[offset+1] = 0, 0
+	delta := n - m
+	// With an odd delta the forward search is the one that finds the overlap
+	odd := delta%2 != 0
+	// Diagonals that ran off the edges are skipped from then on
+	fwdStart, fwdEnd, revStart, revEnd := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + fwdStart; k <= step-fwdEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && fwd[k-1+offset] < fwd[k+1+offset]) {
+				x = fwd[k+1+offset]
+			} else {
+				x = fwd[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			fwd[k+offset] = x
+			switch {
+			case x > n:
+				fwdEnd += 2
+			case y > m:
+				fwdStart += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < size && rev[i] != -1 && x >= n-rev[i] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+		for k := -step + revStart; k <= step-revEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && rev[k-1+offset] < rev[k+1+offset]) {
+				x = rev[k+1+offset]
+			} else {
+				x = rev[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			rev[k+offset] = x
+			switch {
+			case x > n:
+				revEnd += 2
+			case y > m:
+				revStart += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < size && fwd[i] != -1 && fwd[i] >= n-x {
+					fx := fwd[i]
+					return aLo + fx, bLo + fx - (i - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// deletesFirst moves the deletions of every run of changes before its
+// insertions. The two halves of a split can leave them interleaved.
+func deletesFirst(lines []Line) []Line {
+	var inserts []Line
+	out := lines[:0]
+	for i := 0; i < len(lines); i++ {
+		start := i
+		for i < len(lines) && lines[i].Op != Equal {
+			i++
+		}
+		inserts = inserts[:0]
+		for _, line := range lines[start:i] {
+			if line.Op == Delete {
+				out = append(out, line)
+			} else {
+				inserts = append(inserts, line)
+			}
+		}
+		out = append(out, inserts...)
+		if i < len(lines) {
+			out = append(out, lines[i])
+		}
+	}
+	return out
+}
+
+// Unified renders the lines with "+", "-" and " " prefixes, like diff -u
+// without hunk headers
+func Unified(lines []Line) string {
+	var b strings.Builder
+	for _, line := range lines {
+		switch line.Op {
+		case Insert:
+			b.WriteString("+")
+		case Delete:
+			b.WriteString("-")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
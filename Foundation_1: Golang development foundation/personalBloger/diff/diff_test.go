@@ -0,0 +1,155 @@
+package diff
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []Line
+	}{
+		{"both empty", nil, nil, []Line{}},
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, []Line{
+			{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+			{Op: Equal, Text: "b", OldLine: 2, NewLine: 2},
+		}},
+		{"all inserted", nil, []string{"a", "b"}, []Line{
+			{Op: Insert, Text: "a", NewLine: 1},
+			{Op: Insert, Text: "b", NewLine: 2},
+		}},
+		{"all deleted", []string{"a", "b"}, nil, []Line{
+			{Op: Delete, Text: "a", OldLine: 1},
+			{Op: Delete, Text: "b", OldLine: 2},
+		}},
+		{"replaced", []string{"a"}, []string{"b"}, []Line{
+			{Op: Delete, Text: "a", OldLine: 1},
+			{Op: Insert, Text: "b", NewLine: 1},
+		}},
+		{"insert in the middle", []string{"a", "c"}, []string{"a", "b", "c"}, []Line{
+			{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+			{Op: Insert, Text: "b", NewLine: 2},
+			{Op: Equal, Text: "c", OldLine: 2, NewLine: 3},
+		}},
+		{"delete in the middle", []string{"a", "b", "c"}, []string{"a", "c"}, []Line{
+			{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+			{Op: Delete, Text: "b", OldLine: 2},
+			{Op: Equal, Text: "c", OldLine: 3, NewLine: 2},
+		}},
+		{"deletions before insertions", []string{"a", "x", "y", "b"}, []string{"a", "z", "b"}, []Line{
+			{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+			{Op: Delete, Text: "x", OldLine: 2},
+			{Op: Delete, Text: "y", OldLine: 3},
+			{Op: Insert, Text: "z", NewLine: 2},
+			{Op: Equal, Text: "b", OldLine: 4, NewLine: 3},
+		}},
+		{"nothing in common", []string{"a", "b"}, []string{"c", "d", "e"}, []Line{
+			{Op: Delete, Text: "a", OldLine: 1},
+			{Op: Delete, Text: "b", OldLine: 2},
+			{Op: Insert, Text: "c", NewLine: 1},
+			{Op: Insert, Text: "d", NewLine: 2},
+			{Op: Insert, Text: "e", NewLine: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) =\n%+v\nwant\n%+v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinesShortest checks on random texts that the script turns a into b, has
+// consistent line numbers and is as short as the longest common subsequence allows
+func TestLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		lines := Lines(a, b)
+
+		var gotA, gotB []string
+		edits := 0
+		for _, line := range lines {
+			if line.Op != Insert {
+				gotA = append(gotA, line.Text)
+				if line.OldLine != len(gotA) {
+					t.Fatalf("Lines(%q, %q): old line %d, want %d", a, b, line.OldLine, len(gotA))
+				}
+			}
+			if line.Op != Delete {
+				gotB = append(gotB, line.Text)
+				if line.NewLine != len(gotB) {
+					t.Fatalf("Lines(%q, %q): new line %d, want %d", a, b, line.NewLine, len(gotB))
+				}
+			}
+			if line.Op != Equal {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("Lines(%q, %q) does not reproduce the texts", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("Lines(%q, %q) has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// lcs is the length of the longest common subsequence, by dynamic programming
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestLinesLinearMemory(t *testing.T) {
+	a := make([]string, 3000)
+	b := make([]string, 3000)
+	for i := range a {
+		a[i] = "old " + strconv.Itoa(i)
+		b[i] = "new " + strconv.Itoa(i)
+	}
+	allocs := testing.AllocsPerRun(1, func() { Lines(a, b) })
+	// A trace per edit step would be thousands of allocations
+	if allocs > 20 {
+		t.Errorf("Lines allocated %.0f times for two different 3000-line texts", allocs)
+	}
+	if lines := Lines(a, b); len(lines) != 6000 {
+		t.Errorf("len(Lines) = %d, want 6000", len(lines))
+	}
+}
+
+func TestTextTooLarge(t *testing.T) {
+	big := strings.Repeat("line\n", MaxLines/2+1)
+	if _, err := Text(big, big); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Text() error = %v, want ErrTooLarge", err)
+	}
+	if _, err := Text(big, ""); err != nil {
+		t.Fatalf("Text() error = %v, want nil", err)
+	}
+}
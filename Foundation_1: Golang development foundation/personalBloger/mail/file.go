@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File writes every message to its own .eml file below a directory, so the
+// emails of a development setup can be opened with a mail client
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) *File {
+	return &File{dir: dir, from: from}
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	data, err := Format(f.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return err
+	}
+	// Names sort by time; the random part keeps concurrent messages apart
+	name := time.Now().UTC().Format("20060102T150405.000000000Z") + "-" + randomHex(4) + ".eml"
+	tmp, err := os.CreateTemp(f.dir, ".mail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(f.dir, name))
+}
+
+// Log writes messages to w instead of sending them. It is meant for development:
+// the messages contain single-use tokens.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLog(w io.Writer, from string) *Log {
+	return &Log{w: w, from: from}
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := fmt.Fprintf(l.w, "----- mail from %s to %s -----\nSubject: %s\n\n%s\n-----\n", l.from, msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,92 @@
+// Package mail sends account emails through a Mailer chosen at startup: an SMTP
+// server in production, or files and log output during development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var defaultMailer Mailer = NewLog(os.Stderr, "blog@localhost")
+
+// SetDefault replaces the mailer used by the application
+func SetDefault(m Mailer) {
+	defaultMailer = m
+}
+
+// Default returns the mailer used by the application, which writes messages to
+// stderr unless SetDefault was called
+func Default() Mailer {
+	return defaultMailer
+}
+
+// Format renders the message as an RFC 5322 email with a quoted-printable body
+func Format(from string, msg Message) ([]byte, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, err
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// messageID returns a unique Message-ID in the domain of the sender
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	return "<" + randomHex(16) + "@" + domain + ">"
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,16 +1,387 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"personalBloger/auth"
+	"personalBloger/config"
+	"personalBloger/feed"
+	"personalBloger/mail"
+	"personalBloger/middleware"
+	"personalBloger/migrate"
 	"personalBloger/model"
+	"personalBloger/repository"
 	"personalBloger/routes"
+	"personalBloger/storage"
+	"personalBloger/token"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
+// publishInterval is how often scheduled posts are checked
+const publishInterval = 30 * time.Second
+
+const usage = `usage: personalBloger [flags] [command]
+
+commands:
+  migrate <command>  manage the database schema, see "migrate" without a command
+  config             print the effective configuration with secrets redacted
+
+Run with -h to list the flags.
+`
+
+const migrateUsage = `usage: personalBloger [flags] migrate <command>
+
+commands:
+  up              apply all pending migrations
+  down [N]        revert the last N migrations (default 1)
+  to VERSION      migrate up or down to VERSION, 0 reverts everything
+  status          list the migrations and whether they are applied
+  baseline        adopt a database created before versioned migrations
+`
+
 func main() {
+	log := middleware.GetLogger()
+
+	// Settings come from the config file, the environment and flags; what
+	// follows the flags is an optional command
+	cfg, args, err := config.Load(os.Args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, config.ErrUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	level, _ := logrus.ParseLevel(cfg.Log.Level)
+	middleware.SetLogLevel(level)
+	token.AccessTokenTTL = cfg.Auth.AccessTokenTTL
+	token.RefreshTokenTTL = cfg.Auth.RefreshTokenTTL
+
+	if len(args) > 0 {
+		switch args[0] {
+		// "migrate ..." manages the database schema instead of starting the server
+		case "migrate":
+			os.Exit(runMigrate(cfg, args[1:]))
+		// "config" prints the effective settings with secrets redacted
+		case "config":
+			fmt.Print(cfg)
+			return
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+	}
+
+	// Load JWT signing keys
+	if err := loadSigningKeys(cfg.Auth); err != nil {
+		log.WithError(err).Fatal("failed to load signing keys")
+	}
+	// Choose where uploaded media is stored
+	if err := loadStorage(cfg.Storage); err != nil {
+		log.WithError(err).Fatal("failed to configure media storage")
+	}
+	// Configure the RSS and Atom feeds
+	feedSettings := feed.Current()
+	feedSettings.Title = cfg.Feed.Title
+	feedSettings.Description = cfg.Feed.Description
+	feedSettings.BaseURL = cfg.Feed.SiteURL
+	feedSettings.Content = feed.ContentMode(cfg.Feed.Content)
+	feed.Configure(feedSettings)
+	// Configure how failed logins lock accounts out
+	policy := auth.DefaultLockoutPolicy
+	policy.MaxFailures = cfg.Lockout.MaxFailures
+	policy.IPMaxFailures = cfg.Lockout.IPMaxFailures
+	policy.Duration = cfg.Lockout.Duration
+	auth.SetLockoutPolicy(policy)
+	// Enable login through an OpenID Connect provider
+	if cfg.OIDC.Issuer != "" {
+		auth.ConfigureOIDC(auth.OIDCConfig{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+	}
+	// Choose how account emails are delivered
+	if err := loadMailer(cfg.Mail); err != nil {
+		log.WithError(err).Fatal("failed to configure the mailer")
+	}
+	// Decide what users may do before verifying their email address
+	model.SetUnverifiedPolicy(model.UnverifiedPolicy(cfg.Auth.UnverifiedPolicy))
 	// Initialize database (sets model.DB global variable)
-	model.InitDB()
+	model.InitDB(cfg.Database.DSN)
+	// Bring the schema up to date, refusing schemas this version does not know
+	if err := migrateOnStart(); err != nil {
+		log.WithError(err).Fatal("failed to migrate the database")
+	}
+	// Full-text search needs SQLite built with FTS5
+	if cfg.Search.Disabled {
+		if err := model.DisableSearchIndex(model.DB); err != nil {
+			log.WithError(err).Fatal("failed to disable full-text search")
+		}
+		log.Warn("full-text search is disabled by search.disabled")
+	} else if err := model.InitSearchIndex(model.DB); err != nil {
+		log.WithError(err).Fatal("failed to create the full-text search index; build with -tags sqlite_fts5, or set search.disabled to run without search")
+	}
+	// Promote the configured administrators
+	if err := model.PromoteAdmins(model.DB, cfg.Auth.AdminUsernames); err != nil {
+		log.WithError(err).Fatal("failed to promote administrators")
+	}
+	// Publish scheduled posts in the background
+	go publishScheduledPosts(publishInterval)
 	// Setup routes
-	r := routes.InitRoutes()
+	r := routes.InitRoutes(repository.NewGormStore(model.DB), middleware.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	})
+	// Client IPs, which rate limits are keyed by, are only taken from
+	// X-Forwarded-For when the request comes through a trusted proxy
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.WithError(err).Fatal("invalid server.trusted_proxies")
+	}
 
 	// Start server
-	r.Run(":8080")
+	if err := r.Run(cfg.Server.Addr); err != nil {
+		log.WithError(err).Fatal("server stopped")
+	}
+}
+
+// loadSigningKeys reads the keys file named by jwt_keys_file, falling back to a
+// single HS256 key from jwt_secret, and finally to a random development key.
+func loadSigningKeys(cfg config.Auth) error {
+	log := middleware.GetLogger()
+
+	if path := cfg.JWTKeysFile; path != "" {
+		keys, err := token.LoadKeyManager(path)
+		if err != nil {
+			return err
+		}
+		token.SetKeyManager(keys)
+		go reloadKeysOnSignal(keys, path)
+		return nil
+	}
+	if secret := cfg.JWTSecret; secret != "" {
+		keys, err := token.NewKeyManager(token.KeysConfig{Keys: []token.KeyConfig{{
+			ID:        "default",
+			Algorithm: "HS256",
+			Status:    token.KeyActive,
+			Secret:    secret,
+		}}})
+		if err != nil {
+			return err
+		}
+		token.SetKeyManager(keys)
+		return nil
+	}
+	log.Warn("auth.jwt_keys_file and auth.jwt_secret are not set, using a random signing key; tokens will not survive a restart")
+	return nil
+}
+
+// reloadKeysOnSignal re-reads the keys file on SIGHUP so keys can be rotated without a restart
+func reloadKeysOnSignal(keys *token.KeyManager, path string) {
+	log := middleware.GetLogger()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		cfg, err := token.LoadKeysConfig(path)
+		if err == nil {
+			err = keys.Reload(cfg)
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to reload signing keys, keeping the current ones")
+			continue
+		}
+		log.Info("signing keys reloaded")
+	}
+}
+
+// loadStorage selects the media storage backend: "local" keeps files under
+// media_dir, "s3" uses an S3-compatible bucket
+func loadStorage(cfg config.Storage) error {
+	if cfg.Backend == "s3" {
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		})
+		if err != nil {
+			return err
+		}
+		storage.SetDefault(s3)
+		return nil
+	}
+	storage.SetDefault(storage.NewLocal(cfg.MediaDir))
+	return nil
+}
+
+// loadMailer selects how emails are sent: "log" prints them, "file" writes .eml
+// files to dir and "smtp" sends them through smtp_host
+func loadMailer(cfg config.Mail) error {
+	switch cfg.Mailer {
+	case "file":
+		mail.SetDefault(mail.NewFile(cfg.Dir, cfg.From))
+	case "smtp":
+		smtp, err := mail.NewSMTP(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		})
+		if err != nil {
+			return err
+		}
+		mail.SetDefault(smtp)
+	default:
+		mail.SetDefault(mail.NewLog(os.Stderr, cfg.From))
+	}
+	return nil
+}
+
+// publishScheduledPosts flips scheduled posts to published once their time has come
+func publishScheduledPosts(interval time.Duration) {
+	log := middleware.GetLogger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := model.PublishDuePosts(model.DB)
+		if err != nil {
+			log.WithError(err).Error("failed to publish scheduled posts")
+		} else if n > 0 {
+			log.WithField("count", n).Info("published scheduled posts")
+		}
+		<-ticker.C
+	}
+}
+
+// migrateOnStart applies pending migrations. It fails on databases that were
+// migrated by a newer version or created before versioned migrations.
+func migrateOnStart() error {
+	log := middleware.GetLogger()
+
+	migrator, err := migrate.New(model.DB)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		log.WithField("version", m.Version).WithField("name", m.Name).Info("applied migration")
+	}
+	return err
+}
+
+// runMigrate carries out the migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	model.InitDB(cfg.Database.DSN)
+	migrator, err := migrate.New(model.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var ran []migrate.Migration
+	verb := "applied"
+	switch args[0] {
+	case "up":
+		ran, err = migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				fmt.Fprintln(os.Stderr, "invalid number of migrations "+args[1])
+				return 2
+			}
+		}
+		verb = "reverted"
+		ran, err = migrator.Down(steps)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Fprintln(os.Stderr, "invalid version "+args[1])
+			return 2
+		}
+		current, versionErr := migrator.Version()
+		if versionErr != nil {
+			fmt.Fprintln(os.Stderr, versionErr)
+			return 1
+		}
+		if version < current {
+			verb = "reverted"
+		}
+		ran, err = migrator.To(version)
+	case "status":
+		return printMigrationStatus(migrator)
+	case "baseline":
+		if err := migrator.Baseline(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("database adopted, run \"migrate up\" to apply newer migrations")
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	for _, m := range ran {
+		fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(ran) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return 0
+}
+
+// printMigrationStatus lists every migration with the time it was applied
+func printMigrationStatus(migrator *migrate.Migrator) int {
+	list, err := migrator.Status()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, s := range list {
+		status := "pending"
+		if s.AppliedAt != nil {
+			status = "applied " + s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if !s.Known {
+			status += " (unknown to this version)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	w.Flush()
+	return 0
 }
@@ -0,0 +1,107 @@
+// Package media checks uploaded files and makes thumbnails of images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize = 10 << 20
+	// MaxPixels guards against images that are small files but huge once decoded
+	MaxPixels = 50_000_000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels
+	ThumbnailSize = 320
+)
+
+var ErrTooManyPixels = errors.New("Image dimensions are too large")
+
+// allowedTypes maps the accepted content types to the file extension used in storage
+var allowedTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// DetectType sniffs the content type from the data itself, ignoring whatever
+// the client claimed, and reports whether uploads of that type are accepted
+func DetectType(data []byte) (contentType, ext string, ok bool) {
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "", "", false
+	}
+	ext, ok = allowedTypes[contentType]
+	return contentType, ext, ok
+}
+
+// IsImage reports whether thumbnails can be made for the content type
+func IsImage(contentType string) bool {
+	return contentType != "application/pdf" && allowedTypes[contentType] != ""
+}
+
+// Thumbnail is a scaled-down copy of an image
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// ImageSize returns the dimensions of the image without decoding all of it
+func ImageSize(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return 0, 0, ErrTooManyPixels
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// MakeThumbnail scales the image so its longest side is at most ThumbnailSize.
+// JPEGs stay JPEGs; everything else becomes a PNG so transparency is kept.
+func MakeThumbnail(data []byte, contentType string) (*Thumbnail, error) {
+	if _, _, err := ImageSize(data); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+			return nil, err
+		}
+		return &Thumbnail{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg"}, nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return &Thumbnail{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png"}, nil
+}
@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"net/http"
+	"personalBloger/model"
+	"personalBloger/rbac"
+	"personalBloger/token"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,35 +19,138 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		// step 2: Extract token from "Bearer <token>"
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(401, gin.H{"error": "Bearer token required"})
+		authenticate(c, authHeader, "")
+	}
+}
+
+// TokenAuth is AuthMiddleware that also accepts personal access tokens. A token
+// needs the read scope for GET and HEAD requests and writeScope for the others.
+func TokenAuth(writeScope rbac.TokenScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(401, gin.H{"error": "Authorization header is required"})
 			c.Abort()
 			return
 		}
-		// step 3: parse and verify jwt token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte("your_secret_key"), nil
-		})
+		authenticate(c, authHeader, writeScope)
+	}
+}
 
-		if err != nil {
-			c.JSON(401, gin.H{"error": "Invalid token: " + err.Error()})
+// OptionalAuth identifies the caller when an Authorization header is sent and
+// lets anonymous requests through. Handlers check c.Get("user_id") to tell the
+// two apart. A header with an invalid token is still rejected. Personal access
+// tokens need the read scope.
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			authenticate(c, authHeader, rbac.ScopeRead)
+		}
+	}
+}
+
+// authenticate verifies the bearer token in authHeader and stores the caller in
+// the context, aborting the request when the token is not acceptable. Personal
+// access tokens are only accepted when writeScope is set.
+func authenticate(c *gin.Context, authHeader string, writeScope rbac.TokenScope) {
+	// step 2: Extract token from "Bearer <token>"
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		c.JSON(401, gin.H{"error": "Bearer token required"})
+		c.Abort()
+		return
+	}
+	if strings.HasPrefix(tokenString, token.PersonalTokenPrefix) {
+		if writeScope == "" {
+			c.JSON(403, gin.H{"error": "Personal access tokens cannot be used for this endpoint"})
 			c.Abort()
 			return
 		}
-		if !token.Valid {
-			c.JSON(401, gin.H{"error": "Token is not valid"})
+		authenticateAPIToken(c, tokenString, writeScope)
+		return
+	}
+	// step 3: parse and verify jwt token
+	claims, err := token.ParseAccessToken(tokenString)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid token: " + err.Error()})
+		c.Abort()
+		return
+	}
+	// step 4: make sure the session behind the token has not been revoked
+	var session model.Session
+	if err := model.DB.Where("id = ?", claims.SessionID).First(&session).Error; err != nil || !session.IsActive() {
+		c.JSON(401, gin.H{"error": "Token has been revoked"})
+		c.Abort()
+		return
+	}
+	role, ok := rbac.ParseRole(claims.Role)
+	if !ok {
+		c.JSON(401, gin.H{"error": "Token has an unknown role"})
+		c.Abort()
+		return
+	}
+	// step 5: restrict unverified users if the policy says so
+	if model.CurrentUnverifiedPolicy() != model.UnverifiedAllow {
+		var user model.User
+		if err := model.DB.Select("email_verified_at").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+			c.JSON(401, gin.H{"error": "Token has been revoked"})
 			c.Abort()
 			return
 		}
-		//step 4:Extract claims (user data from token)
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["id"])
-			c.Set("username", claims["username"])
-		}
+		c.Set("unverified", !user.Verified())
+	}
+	// step 6:Extract claims (user data from token)
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", role)
+	c.Set("session_id", claims.SessionID)
+}
+
+// authenticateAPIToken checks a personal access token and the scope the request
+// needs, then stores the token's owner in the context
+func authenticateAPIToken(c *gin.Context, tokenString string, writeScope rbac.TokenScope) {
+	var apiToken model.APIToken
+	if err := model.DB.Where("token_hash = ?", token.Hash(tokenString)).First(&apiToken).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+	if !apiToken.IsActive() {
+		c.JSON(401, gin.H{"error": "Token has expired"})
+		c.Abort()
+		return
+	}
+	scope := writeScope
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		scope = rbac.ScopeRead
+	}
+	if !apiToken.HasScope(scope) {
+		c.JSON(403, gin.H{"error": "Token is missing the " + string(scope) + " scope"})
+		c.Abort()
+		return
+	}
+	// The role is read from the user rather than fixed when the token was made,
+	// so a demotion applies to existing tokens straight away
+	var user model.User
+	if err := model.DB.Select("id", "username", "role", "email_verified_at").Where("id = ?", apiToken.UserID).First(&user).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Token has been revoked"})
+		c.Abort()
+		return
+	}
+	role, ok := rbac.ParseRole(string(user.Role))
+	if !ok {
+		c.JSON(401, gin.H{"error": "Token has an unknown role"})
+		c.Abort()
+		return
+	}
+	if model.CurrentUnverifiedPolicy() != model.UnverifiedAllow {
+		c.Set("unverified", !user.Verified())
+	}
+	if err := model.TouchAPIToken(model.DB, &apiToken); err != nil {
+		c.Error(err)
 	}
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", role)
+	c.Set("api_token_id", apiToken.ID)
 }
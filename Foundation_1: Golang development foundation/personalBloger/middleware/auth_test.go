@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"personalBloger/migrate"
+	"personalBloger/model"
+	"personalBloger/rbac"
+	"personalBloger/token"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openDB points model.DB at a migrated database in a temporary directory
+func openDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	previous := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = previous })
+}
+
+// createAPIToken stores a personal access token of user with the scopes and
+// returns it
+func createAPIToken(t *testing.T, user *model.User, expiresAt *time.Time, scopes ...rbac.TokenScope) string {
+	t.Helper()
+	plain := token.NewPersonalToken()
+	apiToken := model.APIToken{UserID: user.ID, Name: "script", TokenHash: token.Hash(plain), Scopes: scopes, ExpiresAt: expiresAt}
+	if err := model.DB.Create(&apiToken).Error; err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+// tokenRouter guards routes the way routes.InitRoutes does: post and comment
+// routes take personal access tokens, the others need a login session
+func tokenRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.JSON(200, gin.H{"user_id": c.GetUint("user_id")}) }
+	r.GET("/post", TokenAuth(rbac.ScopePostsWrite), ok)
+	r.POST("/post", TokenAuth(rbac.ScopePostsWrite), ok)
+	r.POST("/comment", TokenAuth(rbac.ScopeCommentsWrite), ok)
+	r.GET("/tokens", AuthMiddleware(), ok)
+	r.POST("/tokens", AuthMiddleware(), ok)
+	r.POST("/auth/2fa/disable", AuthMiddleware(), ok)
+	return r
+}
+
+func TestTokenAuthScopes(t *testing.T) {
+	openDB(t)
+	user := &model.User{Username: "alice", Password: "password123", Email: "alice@example.com"}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Minute)
+	readToken := createAPIToken(t, user, nil, rbac.ScopeRead)
+	postsToken := createAPIToken(t, user, nil, rbac.ScopeRead, rbac.ScopePostsWrite)
+	commentsToken := createAPIToken(t, user, nil, rbac.ScopeCommentsWrite)
+	expiredToken := createAPIToken(t, user, &expired, rbac.ScopeRead, rbac.ScopePostsWrite)
+
+	tests := []struct {
+		name     string
+		token    string
+		method   string
+		target   string
+		wantCode int
+	}{
+		{"read token reads", readToken, "GET", "/post", http.StatusOK},
+		{"read token writes", readToken, "POST", "/post", http.StatusForbidden},
+		{"posts:write token writes posts", postsToken, "POST", "/post", http.StatusOK},
+		{"comments:write token writes comments", commentsToken, "POST", "/comment", http.StatusOK},
+		{"comments:write token writes posts", commentsToken, "POST", "/post", http.StatusForbidden},
+		{"comments:write token reads", commentsToken, "GET", "/post", http.StatusForbidden},
+		{"expired token reads", expiredToken, "GET", "/post", http.StatusUnauthorized},
+		{"expired token writes", expiredToken, "POST", "/post", http.StatusUnauthorized},
+		{"unknown token", token.NewPersonalToken(), "GET", "/post", http.StatusUnauthorized},
+		{"listing tokens", postsToken, "GET", "/tokens", http.StatusForbidden},
+		{"creating a token", postsToken, "POST", "/tokens", http.StatusForbidden},
+		{"disabling two-factor", postsToken, "POST", "/auth/2fa/disable", http.StatusForbidden},
+	}
+	r := tokenRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("%s %s status = %d, want %d, body %s", tt.method, tt.target, w.Code, tt.wantCode, w.Body)
+			}
+		})
+	}
+}
@@ -81,6 +81,11 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// SetLogLevel changes the level below which entries are dropped
+func SetLogLevel(level logrus.Level) {
+	log.SetLevel(level)
+}
+
 // GetLogger returns the logger instance for use in other parts of the application
 func GetLogger() *logrus.Logger {
 	return log
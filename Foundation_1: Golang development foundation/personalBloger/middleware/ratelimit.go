@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"math"
+	"personalBloger/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateKey picks the client a request is counted against
+type RateKey func(c *gin.Context) string
+
+// ByIP counts requests per client IP
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser counts requests per authenticated user and falls back to the client IP
+// for anonymous requests. It must run after AuthMiddleware or OptionalAuth.
+func ByUser(c *gin.Context) string {
+	if userID := c.GetUint("user_id"); userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	return ByIP(c)
+}
+
+// RateLimit gives every client a token bucket per route and rejects requests
+// with 429 once it is empty. The name keeps the buckets of limiters on the same
+// routes apart. If the store fails the request is let through. It panics on
+// an invalid limit, since that is a mistake in the route setup.
+func RateLimit(name string, limit ratelimit.Limit, key RateKey) gin.HandlerFunc {
+	if err := limit.Validate(); err != nil {
+		panic("rate limit " + name + ": " + err.Error())
+	}
+	return func(c *gin.Context) {
+		result, err := ratelimit.Default().Take(c.Request.Context(), name+":"+c.FullPath()+":"+key(c), limit)
+		if err != nil {
+			log.WithError(err).WithField("limiter", name).Error("rate limit store failed")
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			c.JSON(429, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers expect
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
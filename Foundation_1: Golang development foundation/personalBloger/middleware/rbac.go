@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"personalBloger/rbac"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OwnerCheck reports whether the user owns the resource addressed by the request.
+// It should return gorm.ErrRecordNotFound when the resource does not exist.
+type OwnerCheck func(c *gin.Context, userID uint) (bool, error)
+
+// currentRole returns the role set by AuthMiddleware
+func currentRole(c *gin.Context) rbac.Role {
+	if role, ok := c.Get("role"); ok {
+		if r, ok := role.(rbac.Role); ok {
+			return r
+		}
+	}
+	return rbac.RoleUser
+}
+
+// rejectUnverified responds with 403 if the caller has to verify their email
+// address first, see model.UnverifiedPolicy
+func rejectUnverified(c *gin.Context) bool {
+	if c.GetBool("unverified") {
+		c.JSON(403, gin.H{"error": "Please verify your email address to perform this action"})
+		c.Abort()
+		return true
+	}
+	return false
+}
+
+// RequirePermission only lets the request through if the caller's role grants perm.
+// It must run after AuthMiddleware.
+func RequirePermission(perm rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectUnverified(c) {
+			return
+		}
+		if !currentRole(c).Can(perm) {
+			c.JSON(403, gin.H{"error": "You do not have permission to perform this action"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireOwnership lets the request through if the caller's role grants anyPerm,
+// or grants ownPerm and the caller owns the resource. It must run after AuthMiddleware.
+func RequireOwnership(ownPerm, anyPerm rbac.Permission, isOwner OwnerCheck) gin.HandlerFunc {
+	resource := ownPerm.Resource()
+	return func(c *gin.Context) {
+		if rejectUnverified(c) {
+			return
+		}
+		role := currentRole(c)
+		if role.Can(anyPerm) {
+			c.Next()
+			return
+		}
+		if !role.Can(ownPerm) {
+			c.JSON(403, gin.H{"error": "You do not have permission to perform this action"})
+			c.Abort()
+			return
+		}
+
+		owner, err := isOwner(c, c.GetUint("user_id"))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": strings.ToUpper(resource[:1]) + resource[1:] + " not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !owner {
+			c.JSON(403, gin.H{"error": "You can only " + ownPerm.Action() + " your own " + resource})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
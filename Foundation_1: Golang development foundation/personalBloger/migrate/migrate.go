@@ -0,0 +1,385 @@
+// Package migrate applies the numbered SQL migrations embedded in the binary
+// and keeps a history of them in the schema_migrations table.
+//
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// Each one runs in a transaction together with its history row, so a failed
+// migration leaves the schema as it was.
+package migrate
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// baselineVersion is the schema that the releases before migrations created
+// with AutoMigrate
+const baselineVersion = 1
+
+// baselineSchema lists the tables and columns of the baseline version, which
+// Baseline checks before adopting a database
+var baselineSchema = map[string][]string{
+	"users":    {"id", "created_at", "updated_at", "deleted_at", "username", "password", "email"},
+	"posts":    {"id", "created_at", "updated_at", "deleted_at", "user_id", "title", "content"},
+	"comments": {"id", "created_at", "updated_at", "deleted_at", "post_id", "user_id", "content"},
+}
+
+const historyTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version integer PRIMARY KEY,
+	name text NOT NULL,
+	applied_at datetime NOT NULL
+)`
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	// ErrNoHistory means the database has tables but no schema_migrations, so
+	// it was created before versioned migrations. Baseline adopts it.
+	ErrNoHistory = errors.New("the database was created before versioned migrations, back it up and run \"migrate baseline\"")
+	// ErrUnknownVersion means the database has a migration this binary does not
+	// know, usually because a newer version migrated it
+	ErrUnknownVersion = errors.New("the database has migrations this version does not know")
+)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// history is a row of schema_migrations
+type history struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (history) TableName() string {
+	return "schema_migrations"
+}
+
+// Status describes a migration and whether it has been applied. Migrations
+// that are recorded in the database but unknown to this binary have no Up or
+// Down and Known is false.
+type Status struct {
+	Migration
+	Known     bool
+	AppliedAt *time.Time
+}
+
+// Migrator moves a database between schema versions
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for db with the embedded migrations
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads the migrations in fsys, ordered by version
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		m := fileName.FindStringSubmatch(path.Base(name))
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", name)
+		}
+		version, _ := strconv.Atoi(m[1])
+		if version < 1 {
+			return nil, fmt.Errorf("migration %s: versions start at 1", name)
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest is the version the newest embedded migration leads to
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// find returns the embedded migration with the version
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// applied returns the history, oldest first. A database without history is
+// fine when it is empty and ErrNoHistory otherwise.
+func (m *Migrator) applied() ([]history, error) {
+	migrator := m.db.Migrator()
+	if !migrator.HasTable(&history{}) {
+		if migrator.HasTable("users") {
+			return nil, ErrNoHistory
+		}
+		return nil, nil
+	}
+	var rows []history
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Version returns the current schema version, 0 for an empty database
+func (m *Migrator) Version() (int, error) {
+	rows, err := m.applied()
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[len(rows)-1].Version, nil
+}
+
+// Status lists the embedded migrations and any unknown ones in the database
+func (m *Migrator) Status() ([]Status, error) {
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+	var list []Status
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration, Known: true}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		list = append(list, status)
+	}
+	for _, row := range rows {
+		if _, ok := m.find(row.Version); !ok {
+			at := row.AppliedAt
+			list = append(list, Status{Migration: Migration{Version: row.Version, Name: row.Name}, AppliedAt: &at})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Check returns an error unless the schema is one this binary knows. Pending
+// migrations are not an error.
+func (m *Migrator) Check() error {
+	rows, err := m.applied()
+	if err != nil {
+		return err
+	}
+	return m.checkKnown(rows)
+}
+
+// checkKnown returns ErrUnknownVersion for the first row without an embedded migration
+func (m *Migrator) checkKnown(rows []history) error {
+	for _, row := range rows {
+		if _, ok := m.find(row.Version); !ok {
+			return fmt.Errorf("%w: version %d (%s)", ErrUnknownVersion, row.Version, row.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.To(m.Latest())
+}
+
+// Down reverts the last steps migrations and returns them
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if steps < 1 || steps > len(rows) {
+		return nil, fmt.Errorf("cannot revert %d migrations, %d are applied", steps, len(rows))
+	}
+	target := 0
+	if steps < len(rows) {
+		target = rows[len(rows)-steps-1].Version
+	}
+	return m.To(target)
+}
+
+// To migrates up or down until the schema is at version and returns the
+// migrations it applied or reverted, in the order it ran them. Version 0
+// reverts everything.
+func (m *Migrator) To(version int) ([]Migration, error) {
+	if version != 0 {
+		if _, ok := m.find(version); !ok {
+			return nil, fmt.Errorf("there is no migration %d", version)
+		}
+	}
+	rows, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkKnown(rows); err != nil {
+		return nil, err
+	}
+	if err := m.db.Exec(historyTable).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		done[row.Version] = true
+	}
+
+	var ran []Migration
+	// Revert newest first everything above the target
+	for i := len(rows) - 1; i >= 0; i-- {
+		if rows[i].Version <= version {
+			break
+		}
+		migration, _ := m.find(rows[i].Version)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&history{}, migration.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	// Apply oldest first everything up to the target that is missing
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if done[migration.Version] {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&history{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Baseline adopts a database that AutoMigrate created before versioned
+// migrations by recording the migrations up to the baseline version as
+// applied; "migrate up" then brings it to the current schema. The database must
+// have exactly the baseline schema.
+func (m *Migrator) Baseline() error {
+	if _, err := m.applied(); !errors.Is(err, ErrNoHistory) {
+		if err != nil {
+			return err
+		}
+		if m.db.Migrator().HasTable(&history{}) {
+			return errors.New("the database already has a migration history")
+		}
+		return errors.New("the database is empty, run \"migrate up\" instead")
+	}
+	if err := m.checkBaselineSchema(); err != nil {
+		return err
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(historyTable).Error; err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > baselineVersion {
+				break
+			}
+			row := history{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkBaselineSchema returns an error unless the database has the tables and
+// columns of the baseline version and nothing else
+func (m *Migrator) checkBaselineSchema() error {
+	var tables []string
+	err := m.db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&tables).Error
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, ok := baselineSchema[table]; !ok {
+			return fmt.Errorf("the database has a table %s that the baseline schema does not, it was not created by a release before versioned migrations", table)
+		}
+	}
+	if len(tables) != len(baselineSchema) {
+		return fmt.Errorf("the database has the tables %v, the baseline schema has users, posts and comments", tables)
+	}
+	for _, table := range tables {
+		want := baselineSchema[table]
+		var columns []string
+		if err := m.db.Raw("SELECT name FROM pragma_table_info(?)", table).Scan(&columns).Error; err != nil {
+			return err
+		}
+		sort.Strings(columns)
+		sorted := append([]string(nil), want...)
+		sort.Strings(sorted)
+		if !slices.Equal(columns, sorted) {
+			return fmt.Errorf("the %s table has the columns %v, the baseline schema has %v", table, columns, want)
+		}
+	}
+	return nil
+}
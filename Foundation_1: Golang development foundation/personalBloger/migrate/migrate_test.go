@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newMigrator(t *testing.T, db *gorm.DB) *Migrator {
+	t.Helper()
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestUpDownUp(t *testing.T) {
+	m := newMigrator(t, openDB(t))
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := m.To(0); err != nil {
+		t.Fatalf("To(0) error = %v", err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up() after reverting everything error = %v", err)
+	}
+	if version, _ := m.Version(); version != m.Latest() {
+		t.Fatalf("Version() = %d, want %d", version, m.Latest())
+	}
+}
+
+// releasedSchema is a database as the releases before migrations left it
+func releasedSchema(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openDB(t)
+	up, err := files.ReadFile("migrations/0001_initial_schema.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{
+		string(up),
+		"INSERT INTO users (id, created_at, updated_at, username, password, email) VALUES (1, '2024-01-01 10:00:00', '2024-01-01 10:00:00', 'alice', 'hash', 'alice@example.com')",
+		"INSERT INTO posts (id, created_at, updated_at, user_id, title, content) VALUES (1, '2024-01-02 10:00:00', '2024-01-03 10:00:00', 1, 'Hello', 'World')",
+		"INSERT INTO comments (id, created_at, updated_at, post_id, user_id, content) VALUES (7, '2024-01-04 10:00:00', '2024-01-04 10:00:00', 1, 1, 'Nice')",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestBaselineUpgradesReleasedSchema(t *testing.T) {
+	db := releasedSchema(t)
+	m := newMigrator(t, db)
+	if err := m.Check(); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("Check() error = %v, want ErrNoHistory", err)
+	}
+	if err := m.Baseline(); err != nil {
+		t.Fatalf("Baseline() error = %v", err)
+	}
+	if version, _ := m.Version(); version != baselineVersion {
+		t.Fatalf("Version() after Baseline = %d, want %d", version, baselineVersion)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var path string
+	db.Raw("SELECT path FROM comments WHERE id = 7").Scan(&path)
+	if path != "0000000007" {
+		t.Errorf("comment path = %q, want 0000000007", path)
+	}
+	var published int64
+	db.Raw("SELECT COUNT(*) FROM posts WHERE status = 'published' AND julianday(publish_at) = julianday(created_at)").Scan(&published)
+	if published != 1 {
+		t.Errorf("existing post is not published at its creation time")
+	}
+	var grandfathered int64
+	db.Raw("SELECT COUNT(*) FROM users WHERE email_verified_at = created_at").Scan(&grandfathered)
+	if grandfathered != 1 {
+		t.Errorf("existing user is not verified as of their creation time")
+	}
+	var revisions int64
+	db.Raw("SELECT COUNT(*) FROM post_revisions WHERE post_id = 1 AND number = 1 AND title = 'Hello'").Scan(&revisions)
+	if revisions != 1 {
+		t.Errorf("existing post has %d first revisions, want 1", revisions)
+	}
+}
+
+func TestBaselineRejectsOtherSchemas(t *testing.T) {
+	db := releasedSchema(t)
+	if err := db.Exec("CREATE TABLE sessions (id text PRIMARY KEY)").Error; err != nil {
+		t.Fatal(err)
+	}
+	err := newMigrator(t, db).Baseline()
+	if err == nil || !strings.Contains(err.Error(), "sessions") {
+		t.Fatalf("Baseline() error = %v, want one naming the sessions table", err)
+	}
+
+	db = releasedSchema(t)
+	if err := db.Exec("ALTER TABLE users ADD COLUMN role text").Error; err != nil {
+		t.Fatal(err)
+	}
+	err = newMigrator(t, db).Baseline()
+	if err == nil || !strings.Contains(err.Error(), "users") {
+		t.Fatalf("Baseline() error = %v, want one naming the users table", err)
+	}
+}
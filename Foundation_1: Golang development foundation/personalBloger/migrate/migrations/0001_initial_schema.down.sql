@@ -0,0 +1,5 @@
+-- The full-text index is created outside migrations but depends on posts and comments
+DROP TABLE IF EXISTS `search_index`;
+DROP TABLE `comments`;
+DROP TABLE `posts`;
+DROP TABLE `users`;
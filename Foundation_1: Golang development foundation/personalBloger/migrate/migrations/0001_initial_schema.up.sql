@@ -0,0 +1,41 @@
+-- The schema that the releases before versioned migrations created with
+-- AutoMigrate. Databases from those releases are adopted at this version with
+-- "migrate baseline".
+
+CREATE TABLE `users` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `username` text,
+    `password` text,
+    `email` text
+);
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE `posts` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` integer NOT NULL,
+    `title` text,
+    `content` text,
+    CONSTRAINT `fk_users_posts` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+CREATE INDEX `idx_posts_user_id` ON `posts`(`user_id`);
+CREATE INDEX `idx_posts_deleted_at` ON `posts`(`deleted_at`);
+
+CREATE TABLE `comments` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `post_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `content` text,
+    CONSTRAINT `fk_posts_comments` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`)
+);
+CREATE INDEX `idx_comments_user_id` ON `comments`(`user_id`);
+CREATE INDEX `idx_comments_post_id` ON `comments`(`post_id`);
+CREATE INDEX `idx_comments_deleted_at` ON `comments`(`deleted_at`);
@@ -0,0 +1,23 @@
+CREATE TABLE `sessions` (
+    `id` text,
+    `user_id` integer NOT NULL,
+    `expires_at` datetime,
+    `revoked_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+
+CREATE TABLE `refresh_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `session_id` text NOT NULL,
+    `user_id` integer NOT NULL,
+    `token_hash` text NOT NULL,
+    `expires_at` datetime,
+    `used_at` datetime,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_refresh_tokens_token_hash` ON `refresh_tokens`(`token_hash`);
+CREATE INDEX `idx_refresh_tokens_user_id` ON `refresh_tokens`(`user_id`);
+CREATE INDEX `idx_refresh_tokens_session_id` ON `refresh_tokens`(`session_id`);
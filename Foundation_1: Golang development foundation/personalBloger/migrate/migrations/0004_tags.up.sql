@@ -0,0 +1,15 @@
+CREATE TABLE `tags` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL,
+    `slug` text NOT NULL,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_tags_slug` ON `tags`(`slug`);
+
+CREATE TABLE `post_tags` (
+    `tag_id` integer,
+    `post_id` integer,
+    PRIMARY KEY (`tag_id`,`post_id`),
+    CONSTRAINT `fk_post_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`),
+    CONSTRAINT `fk_post_tags_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`)
+);
@@ -0,0 +1,10 @@
+-- The search triggers read comments.deleted; startup recreates them
+DROP TRIGGER IF EXISTS `comments_search_insert`;
+DROP TRIGGER IF EXISTS `comments_search_update`;
+DROP TRIGGER IF EXISTS `comments_search_delete`;
+DROP INDEX `idx_comments_parent_id`;
+DROP INDEX `idx_comments_path`;
+ALTER TABLE `comments` DROP COLUMN `deleted`;
+ALTER TABLE `comments` DROP COLUMN `path`;
+ALTER TABLE `comments` DROP COLUMN `depth`;
+ALTER TABLE `comments` DROP COLUMN `parent_id`;
@@ -0,0 +1,9 @@
+ALTER TABLE `comments` ADD COLUMN `parent_id` integer;
+ALTER TABLE `comments` ADD COLUMN `depth` integer NOT NULL DEFAULT 0;
+ALTER TABLE `comments` ADD COLUMN `path` text;
+ALTER TABLE `comments` ADD COLUMN `deleted` numeric NOT NULL DEFAULT false;
+CREATE INDEX `idx_comments_path` ON `comments`(`path`);
+CREATE INDEX `idx_comments_parent_id` ON `comments`(`parent_id`);
+
+-- Existing comments are top-level; their path is their zero-padded ID
+UPDATE `comments` SET `path` = printf('%010d', `id`);
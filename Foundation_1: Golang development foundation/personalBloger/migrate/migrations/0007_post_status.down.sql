@@ -0,0 +1,4 @@
+DROP INDEX `idx_posts_status`;
+DROP INDEX `idx_posts_publish_at`;
+ALTER TABLE `posts` DROP COLUMN `publish_at`;
+ALTER TABLE `posts` DROP COLUMN `status`;
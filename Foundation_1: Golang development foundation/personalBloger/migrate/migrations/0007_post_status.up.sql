@@ -0,0 +1,7 @@
+ALTER TABLE `posts` ADD COLUMN `status` text NOT NULL DEFAULT "published";
+ALTER TABLE `posts` ADD COLUMN `publish_at` datetime;
+CREATE INDEX `idx_posts_publish_at` ON `posts`(`publish_at`);
+CREATE INDEX `idx_posts_status` ON `posts`(`status`);
+
+-- Existing posts were published when they were created
+UPDATE `posts` SET `publish_at` = `created_at`;
@@ -0,0 +1,16 @@
+CREATE TABLE `post_revisions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `post_id` integer NOT NULL,
+    `number` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `title` text,
+    `content` text,
+    `restored_from` integer,
+    `created_at` datetime
+);
+CREATE INDEX `idx_post_revisions_user_id` ON `post_revisions`(`user_id`);
+CREATE UNIQUE INDEX `idx_post_revision` ON `post_revisions`(`post_id`,`number`);
+
+-- Every existing post starts its history with its current version
+INSERT INTO `post_revisions` (`post_id`, `number`, `user_id`, `title`, `content`, `created_at`)
+SELECT `id`, 1, `user_id`, `title`, `content`, COALESCE(`updated_at`, `created_at`) FROM `posts`;
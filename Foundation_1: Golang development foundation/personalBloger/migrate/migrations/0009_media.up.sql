@@ -0,0 +1,18 @@
+CREATE TABLE `media` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `post_id` integer,
+    `key` text NOT NULL,
+    `thumbnail_key` text,
+    `filename` text,
+    `content_type` text NOT NULL,
+    `size` integer,
+    `width` integer,
+    `height` integer,
+    `created_at` datetime,
+    CONSTRAINT `fk_posts_media` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`),
+    CONSTRAINT `fk_users_media` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+CREATE UNIQUE INDEX `idx_media_key` ON `media`(`key`);
+CREATE INDEX `idx_media_post_id` ON `media`(`post_id`);
+CREATE INDEX `idx_media_user_id` ON `media`(`user_id`);
@@ -0,0 +1,10 @@
+CREATE TABLE `reactions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `target_type` text NOT NULL,
+    `target_id` integer NOT NULL,
+    `type` text NOT NULL,
+    `created_at` datetime
+);
+CREATE INDEX `idx_reaction_target` ON `reactions`(`target_type`,`target_id`);
+CREATE UNIQUE INDEX `idx_reaction_unique` ON `reactions`(`user_id`,`target_type`,`target_id`,`type`);
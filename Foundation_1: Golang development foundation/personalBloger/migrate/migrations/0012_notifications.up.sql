@@ -0,0 +1,17 @@
+CREATE TABLE `notifications` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `actor_id` integer NOT NULL,
+    `type` text NOT NULL,
+    `post_id` integer,
+    `comment_id` integer,
+    `read_at` datetime,
+    `created_at` datetime
+);
+CREATE INDEX `idx_notification_user` ON `notifications`(`user_id`,`read_at`);
+
+CREATE TABLE `notification_mutes` (
+    `user_id` integer,
+    `type` text,
+    PRIMARY KEY (`user_id`,`type`)
+);
@@ -0,0 +1,18 @@
+ALTER TABLE `users` ADD COLUMN `email_verified_at` datetime;
+
+-- Accounts created before verification existed are grandfathered as verified,
+-- so that the read_only and block policies do not lock them out
+UPDATE `users` SET `email_verified_at` = COALESCE(`created_at`, CURRENT_TIMESTAMP);
+
+CREATE TABLE `account_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `purpose` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `email` text,
+    `expires_at` datetime,
+    `used_at` datetime,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_account_tokens_token_hash` ON `account_tokens`(`token_hash`);
+CREATE INDEX `idx_account_tokens_user_id` ON `account_tokens`(`user_id`);
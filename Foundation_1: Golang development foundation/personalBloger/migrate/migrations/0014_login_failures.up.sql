@@ -0,0 +1,7 @@
+CREATE TABLE `login_failures` (
+    `subject` text,
+    `count` integer,
+    `last_failed_at` datetime,
+    `locked_until` datetime,
+    PRIMARY KEY (`subject`)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE `external_identities` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `issuer` text NOT NULL,
+    `subject` text NOT NULL,
+    `email` text,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX `idx_external_identity` ON `external_identities`(`issuer`,`subject`);
+CREATE INDEX `idx_external_identities_user_id` ON `external_identities`(`user_id`);
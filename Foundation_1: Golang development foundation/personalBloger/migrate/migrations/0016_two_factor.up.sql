@@ -0,0 +1,29 @@
+CREATE TABLE `two_factors` (
+    `user_id` integer,
+    `secret` text NOT NULL,
+    `enabled_at` datetime,
+    `last_step` integer,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`user_id`)
+);
+
+CREATE TABLE `recovery_codes` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `code_hash` text NOT NULL,
+    `used_at` datetime,
+    `created_at` datetime
+);
+CREATE INDEX `idx_recovery_codes_user_id` ON `recovery_codes`(`user_id`);
+
+CREATE TABLE `two_factor_challenges` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `token_hash` text NOT NULL,
+    `attempts` integer,
+    `expires_at` datetime,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_two_factor_challenges_token_hash` ON `two_factor_challenges`(`token_hash`);
+CREATE INDEX `idx_two_factor_challenges_user_id` ON `two_factor_challenges`(`user_id`);
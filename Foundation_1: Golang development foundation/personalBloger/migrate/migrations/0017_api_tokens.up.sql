@@ -0,0 +1,13 @@
+CREATE TABLE `api_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `name` text NOT NULL,
+    `prefix` text,
+    `token_hash` text NOT NULL,
+    `scopes` text,
+    `expires_at` datetime,
+    `last_used_at` datetime,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_api_tokens_token_hash` ON `api_tokens`(`token_hash`);
+CREATE INDEX `idx_api_tokens_user_id` ON `api_tokens`(`user_id`);
@@ -0,0 +1 @@
+-- Publish times stay in UTC, which the earlier releases read as well
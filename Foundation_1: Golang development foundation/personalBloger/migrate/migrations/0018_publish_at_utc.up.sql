@@ -0,0 +1 @@
+UPDATE `posts` SET `publish_at` = strftime('%Y-%m-%d %H:%M:%f+00:00', `publish_at`) WHERE `publish_at` IS NOT NULL;
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Account token purposes
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+var ErrInvalidAccountToken = errors.New("Invalid or expired token")
+
+// AccountToken is a single-use token sent by email to verify an address or reset
+// a password. Only the SHA-256 hash of the token is stored.
+type AccountToken struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	Purpose   string `json:"purpose" gorm:"size:20;not null"`
+	TokenHash string `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	// Email is the address the token was sent to
+	Email     string     `json:"email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UnverifiedPolicy decides what users may do before verifying their email address
+type UnverifiedPolicy string
+
+const (
+	// UnverifiedAllow treats unverified users like everyone else
+	UnverifiedAllow UnverifiedPolicy = "allow"
+	// UnverifiedReadOnly lets unverified users log in and read, but nothing that needs a permission
+	UnverifiedReadOnly UnverifiedPolicy = "read_only"
+	// UnverifiedBlock refuses to log unverified users in
+	UnverifiedBlock UnverifiedPolicy = "block"
+)
+
+var unverifiedPolicy = UnverifiedAllow
+
+// SetUnverifiedPolicy replaces the policy for unverified users
+func SetUnverifiedPolicy(p UnverifiedPolicy) {
+	unverifiedPolicy = p
+}
+
+// CurrentUnverifiedPolicy returns the policy for unverified users, UnverifiedAllow
+// unless SetUnverifiedPolicy was called
+func CurrentUnverifiedPolicy() UnverifiedPolicy {
+	return unverifiedPolicy
+}
+
+// ValidUnverifiedPolicy reports whether p is one of the policies above
+func ValidUnverifiedPolicy(p UnverifiedPolicy) bool {
+	return p == UnverifiedAllow || p == UnverifiedReadOnly || p == UnverifiedBlock
+}
+
+// SaveAccountToken stores the token and drops the user's earlier unused tokens
+// for the same purpose, so only the latest email works
+func SaveAccountToken(tx *gorm.DB, t *AccountToken) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", t.UserID, t.Purpose).
+			Delete(&AccountToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(t).Error
+	})
+}
+
+// UseAccountToken consumes the token with the given hash. It fails with
+// ErrInvalidAccountToken if the token does not exist, has expired or was used.
+func UseAccountToken(tx *gorm.DB, tokenHash, purpose string) (*AccountToken, error) {
+	var t AccountToken
+	err := tx.Where("token_hash = ? AND purpose = ?", tokenHash, purpose).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+	// Only one of two concurrent requests gets to use the token
+	now := time.Now()
+	result := tx.Model(&AccountToken{}).Where("id = ? AND used_at IS NULL", t.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidAccountToken
+	}
+	t.UsedAt = &now
+	return &t, nil
+}
+
+// MarkEmailVerified records that the user controls email. Nothing changes if the
+// user's address is no longer email.
+func MarkEmailVerified(tx *gorm.DB, userID uint, email string) error {
+	return tx.Model(&User{}).
+		Where("id = ? AND email = ? AND email_verified_at IS NULL", userID, email).
+		Update("email_verified_at", time.Now()).Error
+}
+
+// SetPassword hashes and stores a new password for the user
+func SetPassword(tx *gorm.DB, user *User, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(user).Update("password", string(hashed)).Error; err != nil {
+		return err
+	}
+	user.Password = string(hashed)
+	return nil
+}
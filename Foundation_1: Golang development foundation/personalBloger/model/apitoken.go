@@ -0,0 +1,50 @@
+package model
+
+import (
+	"personalBloger/rbac"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// apiTokenTouchInterval limits how often LastUsedAt is written for a busy token
+const apiTokenTouchInterval = time.Minute
+
+// APIToken is a personal access token that lets scripts act as its owner
+// within its scopes. Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"size:100;not null"`
+	// Prefix is the start of the token, so users can tell their tokens apart
+	Prefix     string            `json:"prefix" gorm:"size:16"`
+	TokenHash  string            `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	Scopes     []rbac.TokenScope `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time        `json:"expires_at"`
+	LastUsedAt *time.Time        `json:"last_used_at"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// IsActive reports whether the token has not expired
+func (t *APIToken) IsActive() bool {
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+// HasScope reports whether the token was given the scope
+func (t *APIToken) HasScope(scope rbac.TokenScope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TouchAPIToken records that the token was just used
+func TouchAPIToken(db *gorm.DB, t *APIToken) error {
+	now := time.Now()
+	if t.LastUsedAt != nil && now.Sub(*t.LastUsedAt) < apiTokenTouchInterval {
+		return nil
+	}
+	return db.Model(t).UpdateColumn("last_used_at", now).Error
+}
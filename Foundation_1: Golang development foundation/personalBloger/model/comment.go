@@ -1,10 +1,150 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxCommentDepth is how deeply replies can nest; top-level comments have depth 0
+	MaxCommentDepth = 5
+	// DeletedCommentContent replaces the content of a deleted comment that still has replies
+	DeletedCommentContent = "[deleted]"
+	// pathSegmentWidth is the zero-padded width of each id in Comment.Path
+	pathSegmentWidth = 10
+)
+
+var (
+	ErrParentNotFound = errors.New("Parent comment not found")
+	ErrParentDeleted  = errors.New("Cannot reply to a deleted comment")
+	ErrMaxDepth       = fmt.Errorf("Replies cannot be nested more than %d levels deep", MaxCommentDepth)
+	ErrCommentDeleted = errors.New("Cannot edit a deleted comment")
+)
 
 type Comment struct {
 	gorm.Model
-	PostID  uint   `json:"post_id" gorm:"not null;index"`
-	UserID  uint   `json:"user_id" gorm:"not null;index"`
+	PostID   uint  `json:"post_id" gorm:"not null;index"`
+	UserID   uint  `json:"user_id" gorm:"not null;index"`
+	ParentID *uint `json:"parent_id" gorm:"index"`
+	Depth    int   `json:"depth" gorm:"not null;default:0"`
+	// Path lists the zero-padded ids from the top-level comment down to this one,
+	// e.g. "0000000003/0000000007". Sorting by path gives thread order.
+	Path    string `json:"path" gorm:"size:255;index"`
 	Content string `json:"content" binding:"required"`
+	// Deleted marks a placeholder left behind so that replies keep their parent
+	Deleted bool `json:"deleted" gorm:"not null;default:false"`
+	// EditedAt is set when the author changes the content; UpdatedAt also
+	// moves for internal updates such as filling in the path
+	EditedAt *time.Time `json:"edited_at"`
+	Edited   bool       `json:"edited" gorm:"-"`
+	// Reactions is filled in by the comment listing and is not stored
+	Reactions *ReactionSummary `json:"reactions,omitempty" gorm:"-"`
+}
+
+// AfterFind derives the edited flag shown in responses
+func (c *Comment) AfterFind(tx *gorm.DB) error {
+	c.Edited = c.EditedAt != nil
+	return nil
+}
+
+// PathSegment returns the zero-padded form of id used in comment paths
+func PathSegment(id uint) string {
+	return fmt.Sprintf("%0*d", pathSegmentWidth, id)
+}
+
+// CreateComment inserts a comment or reply and fills in its depth and path.
+// A reply must belong to the same post as its parent.
+func CreateComment(tx *gorm.DB, comment *Comment) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		parentPath := ""
+		if comment.ParentID != nil {
+			var parent Comment
+			err := tx.Where("id = ? AND post_id = ?", *comment.ParentID, comment.PostID).First(&parent).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrParentNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if parent.Deleted {
+				return ErrParentDeleted
+			}
+			if parent.Depth+1 > MaxCommentDepth {
+				return ErrMaxDepth
+			}
+			comment.Depth = parent.Depth + 1
+			parentPath = parent.Path + "/"
+		}
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		// The path includes the comment's own id, which is only known after the insert
+		comment.Path = parentPath + PathSegment(comment.ID)
+		return tx.Model(comment).Update("path", comment.Path).Error
+	})
+}
+
+// EditComment replaces the content of the comment and records when it was edited
+func EditComment(tx *gorm.DB, comment *Comment, content string) error {
+	if comment.Deleted {
+		return ErrCommentDeleted
+	}
+	now := time.Now()
+	err := tx.Model(comment).Updates(map[string]interface{}{
+		"content":   content,
+		"edited_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	comment.Content = content
+	comment.EditedAt = &now
+	comment.Edited = true
+	return nil
+}
+
+// DeleteComment removes a comment. If it still has replies it is turned into a
+// "[deleted]" placeholder instead, and placeholders whose last reply goes away
+// are removed as well.
+func DeleteComment(tx *gorm.DB, comment *Comment) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		current := comment
+		for {
+			var replies int64
+			if err := tx.Model(&Comment{}).Where("parent_id = ?", current.ID).Count(&replies).Error; err != nil {
+				return err
+			}
+			if replies > 0 {
+				if current.Deleted {
+					return nil
+				}
+				return tx.Model(current).Updates(map[string]interface{}{
+					"content": DeletedCommentContent,
+					"deleted": true,
+				}).Error
+			}
+			if err := tx.Delete(current).Error; err != nil {
+				return err
+			}
+			if current.ParentID == nil {
+				return nil
+			}
+			// Clean up the parent if it was only kept around for this reply
+			var parent Comment
+			err := tx.Where("id = ?", *current.ParentID).First(&parent).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !parent.Deleted {
+				return nil
+			}
+			current = &parent
+		}
+	})
 }
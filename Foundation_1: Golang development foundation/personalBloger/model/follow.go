@@ -0,0 +1,39 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrFollowSelf = errors.New("You cannot follow yourself")
+
+// Follow records that FollowerID follows FolloweeID
+type Follow struct {
+	FollowerID uint      `json:"follower_id" gorm:"primaryKey;autoIncrement:false"`
+	FolloweeID uint      `json:"followee_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowUser makes follower follow followee and reports whether that is new;
+// following again changes nothing
+func FollowUser(tx *gorm.DB, followerID, followeeID uint) (bool, error) {
+	if followerID == followeeID {
+		return false, ErrFollowSelf
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Follow{FollowerID: followerID, FolloweeID: followeeID})
+	return result.RowsAffected > 0, result.Error
+}
+
+// UnfollowUser stops follower following followee; it is not an error if they did not
+func UnfollowUser(tx *gorm.DB, followerID, followeeID uint) error {
+	return tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&Follow{}).Error
+}
+
+// FolloweeIDs is a subquery selecting the ids of the users followerID follows
+func FolloweeIDs(db *gorm.DB, followerID uint) *gorm.DB {
+	return db.Model(&Follow{}).Select("followee_id").Where("follower_id = ?", followerID)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ExternalIdentity links an account at an OpenID Connect provider, identified
+// by its issuer and subject, to a blog user
+type ExternalIdentity struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	UserID  uint   `json:"user_id" gorm:"not null;index"`
+	Issuer  string `json:"issuer" gorm:"size:255;not null;uniqueIndex:idx_external_identity"`
+	Subject string `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_external_identity"`
+	// Email is the address the provider reported at the last login
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FindExternalIdentity returns the identity with the issuer and subject
+func FindExternalIdentity(db *gorm.DB, issuer, subject string) (*ExternalIdentity, error) {
+	var identity ExternalIdentity
+	if err := db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// AvailableUsername turns a name suggested by a provider into a username of 3 to
+// 20 characters that nobody has yet, adding a number when the name is taken
+func AvailableUsername(db *gorm.DB, suggested string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.') {
+			return r
+		}
+		return -1
+	}, suggested)
+	if len(base) > 15 {
+		base = base[:15]
+	}
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	for n := 1; n < 1000; n++ {
+		candidate := base
+		if n > 1 {
+			candidate += strconv.Itoa(n)
+		}
+		var count int64
+		if err := db.Unscoped().Model(&User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("no username available for " + suggested)
+}
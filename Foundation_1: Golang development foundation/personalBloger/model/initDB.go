@@ -8,17 +8,14 @@ import (
 // DB is the global database instance
 var DB *gorm.DB
 
-func InitDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("blog.db"), &gorm.Config{})
+// InitDB opens the SQLite database at dsn, a file name or a file: URI
+func InitDB(dsn string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
 
-	// 自动迁移模型
-	err = db.AutoMigrate(&User{}, &Post{}, &Comment{})
-	if err != nil {
-		panic("failed to migrate database")
-	}
+	// The schema is created and upgraded by the migrate package
 
 	// Assign to global variable
 	DB = db
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginFailure counts recent failed logins for a subject, an account or a client
+// IP, see AccountLoginSubject and IPLoginSubject
+type LoginFailure struct {
+	Subject      string     `json:"subject" gorm:"primaryKey;size:300"`
+	Count        int        `json:"count"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until"`
+}
+
+// AccountLoginSubject counts the failures for a username, whether or not an
+// account has it, so lockouts do not reveal which usernames exist
+func AccountLoginSubject(username string) string {
+	return "user:" + username
+}
+
+// IPLoginSubject counts failures from a client IP
+func IPLoginSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// UpdateLoginFailures loads the failure records of the subjects, in the same
+// order and zero for subjects without one, passes them to update and saves
+// them unless update returns an error. Concurrent updates of the same subjects
+// run one after another, so update sees the counts the last one saved.
+func UpdateLoginFailures(db *gorm.DB, subjects []string, update func(failures []LoginFailure) error) ([]LoginFailure, error) {
+	failures := make([]LoginFailure, len(subjects))
+	for i, subject := range subjects {
+		failures[i] = LoginFailure{Subject: subject}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Writing before reading makes SQLite take the write lock at once;
+		// reading first would let two transactions see the same counts
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&failures).Error; err != nil {
+			return err
+		}
+		var found []LoginFailure
+		if err := tx.Where("subject IN ?", subjects).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, f := range found {
+			for i := range failures {
+				if failures[i].Subject == f.Subject {
+					failures[i] = f
+				}
+			}
+		}
+		if err := update(failures); err != nil {
+			return err
+		}
+		return tx.Save(&failures).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// ClearLoginFailures forgets the failures counted for the subjects
+func ClearLoginFailures(db *gorm.DB, subjects ...string) error {
+	return db.Where("subject IN ?", subjects).Delete(&LoginFailure{}).Error
+}
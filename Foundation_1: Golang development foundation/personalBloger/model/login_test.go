@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openLoginFailures(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&LoginFailure{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpdateLoginFailuresSerializes(t *testing.T) {
+	db := openLoginFailures(t)
+	subjects := []string{AccountLoginSubject("alice"), IPLoginSubject("192.0.2.1")}
+	const attempts, limit = 20, 3
+
+	// Every update checks the count and then raises it, as a login reservation
+	// does; only limit of them may get through
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := UpdateLoginFailures(db, subjects, func(failures []LoginFailure) error {
+				if failures[0].Count >= limit {
+					return errors.New("limit reached")
+				}
+				for i := range failures {
+					failures[i].Count++
+				}
+				return nil
+			})
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != limit {
+		t.Errorf("%d updates got through, want %d", allowed, limit)
+	}
+	var failures []LoginFailure
+	db.Order("subject").Find(&failures)
+	if len(failures) != 2 || failures[0].Count != limit || failures[1].Count != limit {
+		t.Errorf("failures = %+v, want both subjects at %d", failures, limit)
+	}
+}
+
+func TestUpdateLoginFailuresRollsBack(t *testing.T) {
+	db := openLoginFailures(t)
+	_, err := UpdateLoginFailures(db, []string{"user:bob"}, func(failures []LoginFailure) error {
+		failures[0].Count = 5
+		return errors.New("stop")
+	})
+	if err == nil {
+		t.Fatal("UpdateLoginFailures() error = nil, want the update's error")
+	}
+	var count int64
+	db.Model(&LoginFailure{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d records saved after a failed update, want 0", count)
+	}
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Media is an uploaded file. It belongs to the user who uploaded it and can be
+// attached to one of their posts. The file and its thumbnail live in storage
+// under Key and ThumbnailKey.
+type Media struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	PostID       *uint     `json:"post_id" gorm:"index"`
+	Key          string    `json:"-" gorm:"size:255;not null;uniqueIndex"`
+	ThumbnailKey string    `json:"-" gorm:"size:255"`
+	Filename     string    `json:"filename" gorm:"size:255"`
+	ContentType  string    `json:"content_type" gorm:"size:100;not null"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
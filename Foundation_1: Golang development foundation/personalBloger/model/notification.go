@@ -0,0 +1,82 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Notification types
+const (
+	NotifyComment  = "comment"
+	NotifyReply    = "reply"
+	NotifyFollow   = "follow"
+	NotifyReaction = "reaction"
+)
+
+// NotificationTypes lists every notification type, which users can mute one by one
+var NotificationTypes = []string{NotifyComment, NotifyReply, NotifyFollow, NotifyReaction}
+
+// Notification tells UserID that ActorID did something involving them.
+// PostID and CommentID point at what it was about, when that applies.
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_notification_user,priority:1"`
+	ActorID   uint       `json:"actor_id" gorm:"not null"`
+	Type      string     `json:"type" gorm:"size:30;not null"`
+	PostID    *uint      `json:"post_id"`
+	CommentID *uint      `json:"comment_id"`
+	ReadAt    *time.Time `json:"read_at" gorm:"index:idx_notification_user,priority:2"`
+	CreatedAt time.Time  `json:"created_at"`
+	// ActorUsername is filled in by listing queries and is not stored
+	ActorUsername string `json:"actor_username" gorm:"->;-:migration"`
+}
+
+// NotificationMute turns off one type of notification for a user
+type NotificationMute struct {
+	UserID uint   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Type   string `json:"type" gorm:"primaryKey;size:30"`
+}
+
+// ValidNotificationType reports whether t is one of NotificationTypes
+func ValidNotificationType(t string) bool {
+	for _, allowed := range NotificationTypes {
+		if t == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify stores the notification unless it would tell users about their own
+// actions or its type is muted by the recipient
+func Notify(tx *gorm.DB, n *Notification) error {
+	if n.UserID == 0 || n.UserID == n.ActorID {
+		return nil
+	}
+	var muted int64
+	if err := tx.Model(&NotificationMute{}).Where("user_id = ? AND type = ?", n.UserID, n.Type).Count(&muted).Error; err != nil {
+		return err
+	}
+	if muted > 0 {
+		return nil
+	}
+	return tx.Create(n).Error
+}
+
+// MutedNotificationTypes returns the types the user has muted
+func MutedNotificationTypes(db *gorm.DB, userID uint) ([]string, error) {
+	var types []string
+	err := db.Model(&NotificationMute{}).Where("user_id = ?", userID).Pluck("type", &types).Error
+	return types, err
+}
+
+// SetNotificationMuted mutes or unmutes one notification type for the user
+func SetNotificationMuted(tx *gorm.DB, userID uint, notificationType string, muted bool) error {
+	mute := NotificationMute{UserID: userID, Type: notificationType}
+	if muted {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error
+	}
+	return tx.Where("user_id = ? AND type = ?", userID, notificationType).Delete(&NotificationMute{}).Error
+}
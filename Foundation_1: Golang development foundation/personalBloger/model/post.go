@@ -1,11 +1,96 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostStatus controls who can see a post. Only published posts are public;
+// the others are visible to their author alone.
+type PostStatus string
+
+const (
+	PostDraft     PostStatus = "draft"
+	PostPublished PostStatus = "published"
+	// PostScheduled posts are published automatically once PublishAt has passed
+	PostScheduled PostStatus = "scheduled"
+	PostArchived  PostStatus = "archived"
+)
+
+var (
+	ErrPublishAtRequired = errors.New("publish_at is required for scheduled posts")
+	ErrPublishAtPast     = errors.New("publish_at must be in the future")
+)
 
 type Post struct {
 	gorm.Model
-	Comments []Comment `json:"comments,omitempty"`
-	UserID   uint      `json:"user_id" gorm:"not null;index"`
-	Title    string    `json:"title" binding:"required"`
-	Content  string    `json:"content" binding:"required"`
+	Comments []Comment  `json:"comments,omitempty"`
+	Media    []Media    `json:"media,omitempty"`
+	UserID   uint       `json:"user_id" gorm:"not null;index"`
+	Title    string     `json:"title" binding:"required"`
+	Content  string     `json:"content" binding:"required"`
+	Tags     []Tag      `json:"tags" gorm:"many2many:post_tags"`
+	Status   PostStatus `json:"status" gorm:"size:20;not null;default:published;index"`
+	// PublishAt is when a scheduled post goes live, or when the post was published
+	PublishAt *time.Time `json:"publish_at" gorm:"index"`
+	// CommentCount is filled in by listing queries and is not stored
+	CommentCount int64 `json:"comment_count" gorm:"->;-:migration"`
+}
+
+// CommentCountSQL counts the live comments of each row in a posts query
+const CommentCountSQL = "(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id AND comments.deleted_at IS NULL)"
+
+// ValidPostStatus reports whether s names a post status
+func ValidPostStatus(s string) bool {
+	switch PostStatus(s) {
+	case PostDraft, PostPublished, PostScheduled, PostArchived:
+		return true
+	}
+	return false
+}
+
+// SetStatus moves the post to status. Scheduling needs a publish time in the
+// future; publishing records the current time unless the post was published before.
+// Publish times are stored in UTC: SQLite compares them as text, which only
+// orders times correctly when they share an offset.
+func (p *Post) SetStatus(status PostStatus, publishAt *time.Time) error {
+	now := time.Now().UTC()
+	switch status {
+	case PostScheduled:
+		if publishAt == nil {
+			return ErrPublishAtRequired
+		}
+		if !publishAt.After(now) {
+			return ErrPublishAtPast
+		}
+		utc := publishAt.UTC()
+		p.PublishAt = &utc
+	case PostPublished:
+		if p.PublishAt == nil || p.Status == PostScheduled {
+			p.PublishAt = &now
+		}
+	case PostDraft:
+		p.PublishAt = nil
+	}
+	p.Status = status
+	return nil
+}
+
+// VisiblePosts limits a posts query to the posts userID may see: every
+// published post plus their own. Pass 0 for anonymous callers. Scheduled posts
+// whose time has come count as published even before PublishDuePosts runs.
+func VisiblePosts(query *gorm.DB, userID uint) *gorm.DB {
+	return query.Where("(posts.status = ? OR (posts.status = ? AND posts.publish_at <= ?) OR posts.user_id = ?)",
+		PostPublished, PostScheduled, time.Now().UTC(), userID)
+}
+
+// PublishDuePosts publishes the scheduled posts whose publish time has passed
+// and returns how many there were
+func PublishDuePosts(db *gorm.DB) (int64, error) {
+	result := db.Model(&Post{}).
+		Where("status = ? AND publish_at <= ?", PostScheduled, time.Now().UTC()).
+		Update("status", PostPublished)
+	return result.RowsAffected, result.Error
 }
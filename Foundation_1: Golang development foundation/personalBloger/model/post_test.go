@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openPostDB returns a database with the posts table
+func openPostDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec("CREATE TABLE posts (id integer PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime, " +
+		"user_id integer, title text, content text, status text, publish_at datetime)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// schedule stores a post by user 1 that is scheduled for publishAt
+func schedule(t *testing.T, db *gorm.DB, publishAt time.Time) *Post {
+	t.Helper()
+	post := &Post{UserID: 1, Title: "Later", Content: "Soon"}
+	if err := post.SetStatus(PostScheduled, &publishAt); err != nil {
+		t.Fatalf("SetStatus(scheduled, %s) error = %v", publishAt, err)
+	}
+	if err := db.Create(post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestScheduledPostsWithOffsets(t *testing.T) {
+	db := openPostDB(t)
+	tokyo := time.FixedZone("+09:00", 9*60*60)
+	newYork := time.FixedZone("-05:00", -5*60*60)
+
+	due := schedule(t, db, time.Now().Add(50*time.Millisecond).In(tokyo))
+	later := schedule(t, db, time.Now().Add(time.Hour).In(newYork))
+	time.Sleep(100 * time.Millisecond)
+
+	var visible []Post
+	if err := VisiblePosts(db.Model(&Post{}), 2).Find(&visible).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(visible) != 1 || visible[0].ID != due.ID {
+		t.Errorf("VisiblePosts() = %d posts, want only the due post %d", len(visible), due.ID)
+	}
+
+	published, err := PublishDuePosts(db)
+	if err != nil {
+		t.Fatalf("PublishDuePosts() error = %v", err)
+	}
+	if published != 1 {
+		t.Errorf("PublishDuePosts() = %d, want 1", published)
+	}
+	var status PostStatus
+	db.Raw("SELECT status FROM posts WHERE id = ?", later.ID).Scan(&status)
+	if status != PostScheduled {
+		t.Errorf("post due in an hour is %s, want scheduled", status)
+	}
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reaction targets
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// ReactionTypes are the reactions users can leave, in display order
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad", "celebrate"}
+
+// Reaction is one user's reaction of one type to a post or comment. A user can
+// leave several types on the same target, but each type only once.
+type Reaction struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_reaction_unique,priority:1"`
+	TargetType string    `json:"target_type" gorm:"size:20;not null;uniqueIndex:idx_reaction_unique,priority:2;index:idx_reaction_target,priority:1"`
+	TargetID   uint      `json:"target_id" gorm:"not null;uniqueIndex:idx_reaction_unique,priority:3;index:idx_reaction_target,priority:2"`
+	Type       string    `json:"type" gorm:"size:20;not null;uniqueIndex:idx_reaction_unique,priority:4"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReactionSummary is what responses show about the reactions to a target: the
+// count per type and the types the caller has used
+type ReactionSummary struct {
+	Counts map[string]int64 `json:"counts"`
+	Mine   []string         `json:"mine"`
+}
+
+// ValidReactionType reports whether t is one of ReactionTypes
+func ValidReactionType(t string) bool {
+	for _, allowed := range ReactionTypes {
+		if t == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReaction records the reaction and reports whether it is new; adding it
+// again changes nothing
+func AddReaction(tx *gorm.DB, userID uint, targetType string, targetID uint, reactionType string) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Reaction{
+		UserID:     userID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Type:       reactionType,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RemoveReaction deletes the reaction; removing a missing reaction changes nothing
+func RemoveReaction(tx *gorm.DB, userID uint, targetType string, targetID uint, reactionType string) error {
+	return tx.Where("user_id = ? AND target_type = ? AND target_id = ? AND type = ?", userID, targetType, targetID, reactionType).
+		Delete(&Reaction{}).Error
+}
+
+// SummarizeReactions returns the reaction summary of each target. userID is
+// the caller, 0 for anonymous callers who have no reactions of their own.
+func SummarizeReactions(db *gorm.DB, targetType string, targetIDs []uint, userID uint) (map[uint]ReactionSummary, error) {
+	summaries := make(map[uint]ReactionSummary, len(targetIDs))
+	for _, id := range targetIDs {
+		summaries[id] = ReactionSummary{Counts: map[string]int64{}, Mine: []string{}}
+	}
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	var counts []struct {
+		TargetID uint
+		Type     string
+		Count    int64
+	}
+	err := db.Model(&Reaction{}).
+		Select("target_id, type, COUNT(*) AS count").
+		Where("target_type = ? AND target_id IN ?", targetType, targetIDs).
+		Group("target_id, type").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range counts {
+		summaries[row.TargetID].Counts[row.Type] = row.Count
+	}
+
+	if userID == 0 {
+		return summaries, nil
+	}
+	var mine []Reaction
+	err = db.Select("target_id", "type").
+		Where("user_id = ? AND target_type = ? AND target_id IN ?", userID, targetType, targetIDs).
+		Order("id").
+		Find(&mine).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, reaction := range mine {
+		summary := summaries[reaction.TargetID]
+		summary.Mine = append(summary.Mine, reaction.Type)
+		summaries[reaction.TargetID] = summary
+	}
+	return summaries, nil
+}
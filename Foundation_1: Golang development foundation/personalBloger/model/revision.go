@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostRevision is an immutable snapshot of a post's title and content.
+// Revisions are numbered from 1 for each post.
+type PostRevision struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	PostID  uint   `json:"post_id" gorm:"not null;uniqueIndex:idx_post_revision"`
+	Number  int    `json:"number" gorm:"not null;uniqueIndex:idx_post_revision"`
+	UserID  uint   `json:"user_id" gorm:"not null;index"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// RestoredFrom is the number of the revision this one was restored from
+	RestoredFrom *int      `json:"restored_from"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RecordRevision snapshots the current title and content of the post as its
+// next revision, written by userID
+func RecordRevision(tx *gorm.DB, post *Post, userID uint, restoredFrom *int) (*PostRevision, error) {
+	var last int
+	err := tx.Model(&PostRevision{}).
+		Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	revision := PostRevision{
+		PostID:       post.ID,
+		Number:       last + 1,
+		UserID:       userID,
+		Title:        post.Title,
+		Content:      post.Content,
+		RestoredFrom: restoredFrom,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
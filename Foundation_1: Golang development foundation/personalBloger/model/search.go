@@ -0,0 +1,123 @@
+package model
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// The search index is an FTS5 table kept in sync with posts and comments by
+// triggers, so every write path (Create, Save, Update, Delete) is covered.
+// Posts use rowid 2*id and comments 2*id+1, which lets the triggers delete
+// index rows by rowid instead of scanning the table.
+const (
+	SearchKindPost    = "post"
+	SearchKindComment = "comment"
+)
+
+var searchTable = []string{
+	`CREATE VIRTUAL TABLE search_index USING fts5(
+		title, body,
+		kind UNINDEXED, ref_id UNINDEXED, post_id UNINDEXED,
+		tokenize = 'porter unicode61'
+	)`,
+	// Index everything that existed before the search index was created
+	`INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+	SELECT id * 2, title, content, 'post', id, id FROM posts WHERE deleted_at IS NULL`,
+	`INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+	SELECT id * 2 + 1, '', content, 'comment', id, post_id FROM comments WHERE deleted_at IS NULL AND deleted = 0`,
+}
+
+var dropSearchTriggers = []string{
+	`DROP TRIGGER IF EXISTS posts_search_insert`,
+	`DROP TRIGGER IF EXISTS posts_search_update`,
+	`DROP TRIGGER IF EXISTS posts_search_delete`,
+	`DROP TRIGGER IF EXISTS comments_search_insert`,
+	`DROP TRIGGER IF EXISTS comments_search_update`,
+	`DROP TRIGGER IF EXISTS comments_search_delete`,
+}
+
+// The triggers are recreated on every start so that changes to them reach existing databases
+var searchTriggers = []string{
+	`CREATE TRIGGER posts_search_insert AFTER INSERT ON posts WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+		VALUES (new.id * 2, new.title, new.content, 'post', new.id, new.id);
+	END`,
+	`CREATE TRIGGER posts_search_update AFTER UPDATE ON posts BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2;
+		INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+		SELECT new.id * 2, new.title, new.content, 'post', new.id, new.id WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER posts_search_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2;
+	END`,
+
+	`CREATE TRIGGER comments_search_insert AFTER INSERT ON comments WHEN new.deleted_at IS NULL AND new.deleted = 0 BEGIN
+		INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+		VALUES (new.id * 2 + 1, '', new.content, 'comment', new.id, new.post_id);
+	END`,
+	`CREATE TRIGGER comments_search_update AFTER UPDATE ON comments BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2 + 1;
+		INSERT INTO search_index(rowid, title, body, kind, ref_id, post_id)
+		SELECT new.id * 2 + 1, '', new.content, 'comment', new.id, new.post_id WHERE new.deleted_at IS NULL AND new.deleted = 0;
+	END`,
+	`CREATE TRIGGER comments_search_delete AFTER DELETE ON comments BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2 + 1;
+	END`,
+}
+
+var searchEnabled bool
+
+// InitSearchIndex creates the full-text index if it does not exist yet and
+// installs its triggers. It fails when SQLite was built without FTS5 (build
+// with -tags sqlite_fts5).
+func InitSearchIndex(db *gorm.DB) error {
+	var stmts []string
+	if !db.Migrator().HasTable("search_index") {
+		stmts = searchTable
+	} else if !hasSearchTriggers(db) {
+		// DisableSearchIndex dropped the triggers, so the index missed the
+		// writes since then; index everything again
+		stmts = append([]string{"DELETE FROM search_index"}, searchTable[1:]...)
+	}
+	stmts = append(append(slices.Clone(stmts), dropSearchTriggers...), searchTriggers...)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	searchEnabled = true
+	return nil
+}
+
+// DisableSearchIndex drops the triggers of an existing index, which would make
+// every write to posts and comments fail on SQLite without FTS5. The index is
+// rebuilt by the next InitSearchIndex.
+func DisableSearchIndex(db *gorm.DB) error {
+	searchEnabled = false
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range dropSearchTriggers {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func hasSearchTriggers(db *gorm.DB) bool {
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'posts_search_insert'").Scan(&count)
+	return count > 0
+}
+
+// SearchEnabled reports whether the full-text index is available
+func SearchEnabled() bool {
+	return searchEnabled
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSearchDB returns a database with the columns the search triggers use. It
+// skips the test when SQLite was built without FTS5.
+func openSearchDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/blog.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE posts (id integer PRIMARY KEY, title text, content text, deleted_at datetime)",
+		"CREATE TABLE comments (id integer PRIMARY KEY, post_id integer, content text, deleted integer DEFAULT 0, deleted_at datetime)",
+		"INSERT INTO posts (id, title, content) VALUES (1, 'Hello', 'golang')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitSearchIndex(db); err != nil {
+		t.Skipf("SQLite has no FTS5, run with -tags sqlite_fts5: %v", err)
+	}
+	return db
+}
+
+func searchHits(t *testing.T, db *gorm.DB, match string) int64 {
+	t.Helper()
+	var hits int64
+	if err := db.Raw("SELECT COUNT(*) FROM search_index WHERE search_index MATCH ?", match).Scan(&hits).Error; err != nil {
+		t.Fatal(err)
+	}
+	return hits
+}
+
+func TestSearchIndexRebuiltAfterDisable(t *testing.T) {
+	db := openSearchDB(t)
+	if searchHits(t, db, "golang") != 1 {
+		t.Fatal("existing post is not indexed")
+	}
+
+	if err := DisableSearchIndex(db); err != nil {
+		t.Fatalf("DisableSearchIndex() error = %v", err)
+	}
+	if SearchEnabled() {
+		t.Error("SearchEnabled() = true after DisableSearchIndex")
+	}
+	// Writes while search is disabled are not indexed
+	db.Exec("UPDATE posts SET content = 'rust' WHERE id = 1")
+	db.Exec("INSERT INTO comments (id, post_id, content) VALUES (1, 1, 'python')")
+	if searchHits(t, db, "rust") != 0 {
+		t.Fatal("the index triggers still run after DisableSearchIndex")
+	}
+
+	if err := InitSearchIndex(db); err != nil {
+		t.Fatalf("InitSearchIndex() error = %v", err)
+	}
+	if golang, rust, python := searchHits(t, db, "golang"), searchHits(t, db, "rust"), searchHits(t, db, "python"); golang != 0 || rust != 1 || python != 1 {
+		t.Errorf("hits after re-enabling: golang %d, rust %d, python %d, want 0, 1, 1", golang, rust, python)
+	}
+	db.Exec("INSERT INTO posts (id, title, content) VALUES (2, 'New', 'elixir')")
+	if searchHits(t, db, "elixir") != 1 {
+		t.Error("posts written after re-enabling are not indexed")
+	}
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session groups the access and refresh tokens issued from one login.
+// Revoking a session invalidates all of them at once.
+type Session struct {
+	ID        string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RefreshToken is a single-use token that can be exchanged for a new token pair.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID string     `json:"session_id" gorm:"not null;index;size:32"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RevokeUserSessions revokes every active session of the user, e.g. after their role changed
+func RevokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
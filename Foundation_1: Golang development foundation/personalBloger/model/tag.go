@@ -0,0 +1,83 @@
+package model
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:30;not null"`
+	Slug      string    `json:"slug" gorm:"size:30;not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+	Posts     []Post    `json:"-" gorm:"many2many:post_tags"`
+}
+
+// NormalizeTagName lower-cases the name and collapses whitespace, so that
+// "Go", "go" and " GO " are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// TagSlug turns a normalized tag name into its URL form, e.g. "web dev" -> "web-dev"
+func TagSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range NormalizeTagName(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// FindOrCreateTags returns the tags with the given names, creating the missing
+// ones. Names are normalized and duplicates are dropped; names that produce an
+// empty slug are ignored.
+func FindOrCreateTags(tx *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		slug := TagSlug(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tags = append(tags, Tag{Name: NormalizeTagName(name), Slug: slug})
+	}
+	if len(tags) == 0 {
+		return tags, nil
+	}
+	// Another request may create the same tag concurrently, so ignore conflicts
+	// and read the rows back
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+	slugs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		slugs = append(slugs, tag.Slug)
+	}
+	tags = tags[:0]
+	if err := tx.Where("slug IN ?", slugs).Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// SetPostTags replaces the tags of the post
+func SetPostTags(tx *gorm.DB, post *Post, names []string) error {
+	tags, err := FindOrCreateTags(tx, names)
+	if err != nil {
+		return err
+	}
+	post.Tags = tags
+	return tx.Model(post).Association("Tags").Replace(tags)
+}
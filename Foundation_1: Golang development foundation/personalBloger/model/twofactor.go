@@ -0,0 +1,106 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactor holds a user's TOTP secret. The secret is pending until the user
+// proves their authenticator works, which sets EnabledAt.
+type TwoFactor struct {
+	UserID    uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret    string     `json:"-" gorm:"size:64;not null"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	// LastStep is the time step of the last accepted code, so no code works twice
+	LastStep  int64     `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TwoFactorChallenge is handed out by a login with the right password and is
+// exchanged, together with a code, for the real tokens
+type TwoFactorChallenge struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	TokenHash string    `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsEnabled reports whether the user has finished enrolment
+func (t *TwoFactor) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
+
+// FindTwoFactor returns the user's TOTP settings, gorm.ErrRecordNotFound if
+// the user never enrolled
+func FindTwoFactor(db *gorm.DB, userID uint) (*TwoFactor, error) {
+	var t TwoFactor
+	if err := db.Where("user_id = ?", userID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// AcceptTOTPStep records that the code of the time step was used. It returns
+// false if that step or a later one was used already.
+func AcceptTOTPStep(tx *gorm.DB, userID uint, step int64) (bool, error) {
+	result := tx.Model(&TwoFactor{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountChallengeAttempt counts an attempt to answer the challenge. It returns
+// false once the challenge has had max attempts.
+func CountChallengeAttempt(db *gorm.DB, challengeID uint, max int) (bool, error) {
+	result := db.Model(&TwoFactorChallenge{}).
+		Where("id = ? AND attempts < ?", challengeID, max).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseRecoveryCode consumes one of the user's unused recovery codes
+func UseRecoveryCode(tx *gorm.DB, userID uint, codeHash string) (bool, error) {
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceRecoveryCodes drops the user's recovery codes and stores new ones
+func ReplaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// DisableTwoFactor removes the user's secret, recovery codes and open challenges
+func DisableTwoFactor(tx *gorm.DB, userID uint) error {
+	for _, model := range []interface{}{&TwoFactor{}, &RecoveryCode{}, &TwoFactorChallenge{}} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
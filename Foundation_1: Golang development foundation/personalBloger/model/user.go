@@ -1,16 +1,28 @@
 package model
 
 import (
+	"personalBloger/rbac"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Posts    []Post `json:"posts,omitempty"`
-	Username string `json:"username" binding:"required, min=3, max=20"`
-	Password string `json:"password" binding:"required, min=8, max=20"`
-	Email    string `json:"email" binding:"required, email"`
+	Posts    []Post    `json:"posts,omitempty"`
+	Media    []Media   `json:"media,omitempty"`
+	Username string    `json:"username" binding:"required, min=3, max=20"`
+	Password string    `json:"-" binding:"required, min=8, max=20"`
+	Email    string    `json:"email" binding:"required, email"`
+	Role     rbac.Role `json:"role" gorm:"size:20;not null;default:user"`
+	// EmailVerifiedAt is when the user proved they control Email
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// Verified reports whether the user's email address has been verified
+func (u *User) Verified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -21,3 +33,12 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	u.Password = string(hashedPassword)
 	return nil
 }
+
+// PromoteAdmins gives the admin role to the named users. It is used to bootstrap
+// the first administrators from the environment.
+func PromoteAdmins(db *gorm.DB, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+	return db.Model(&User{}).Where("username IN ?", usernames).Update("role", rbac.RoleAdmin).Error
+}
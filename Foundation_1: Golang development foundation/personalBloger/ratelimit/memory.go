@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store forgets buckets that are full again
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in the memory of one process
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	// full is when the bucket will be full, after which it can be dropped
+	full time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*memoryBucket)}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		m.buckets[key] = b
+	}
+	result := b.Take(limit, now)
+	b.full = now.Add(result.ResetAfter)
+	return result, nil
+}
+
+// sweep drops the buckets that have refilled completely, since a new bucket
+// behaves exactly the same
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
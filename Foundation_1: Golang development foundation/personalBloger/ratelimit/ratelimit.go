@@ -0,0 +1,110 @@
+// Package ratelimit implements token buckets behind a Store interface, so
+// several instances of the server can share their counters.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrInvalidLimit is returned for limits that allow no requests or have no period
+var ErrInvalidLimit = errors.New("rate limit needs at least one request per positive period")
+
+// Limit allows Requests requests per Period on average, and bursts of up to
+// Burst requests. Burst defaults to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// PerMinute allows n requests a minute
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+// Validate returns ErrInvalidLimit unless the limit allows at least one request
+// per positive period
+func (l Limit) Validate() error {
+	if l.Requests < 1 || l.Period <= 0 || l.Burst < 0 {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+// capacity is the size of the bucket
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// interval is how long it takes to earn one token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result is the state of a bucket after a request was counted
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining what is left in it
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected caller has to wait for a token
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps one bucket per key. Take must count the request and decide
+// atomically, also when several servers share the store, and return
+// ErrInvalidLimit for limits that do not pass Validate.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+var defaultStore Store = NewMemory()
+
+// SetDefault replaces the store used by the application
+func SetDefault(s Store) {
+	defaultStore = s
+}
+
+// Default returns the store used by the application, an in-memory store
+// unless SetDefault was called
+func Default() Store {
+	return defaultStore
+}
+
+// Bucket is the state a store keeps for a key: the tokens it had at Updated
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket for the time since it was last updated and takes a
+// token if there is one. Stores call it while they hold the key, with a limit
+// that passed Validate.
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	capacity := limit.capacity()
+	if b.Updated.IsZero() {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+float64(elapsed)/float64(limit.interval()))
+	}
+	b.Updated = now
+
+	result := Result{Limit: int(capacity)}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.Tokens) * float64(limit.interval()))
+	}
+	result.Remaining = int(b.Tokens)
+	result.ResetAfter = time.Duration((capacity - b.Tokens) * float64(limit.interval()))
+	return result
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimitValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		valid bool
+	}{
+		{"per minute", PerMinute(10), true},
+		{"with burst", Limit{Requests: 1, Period: time.Second, Burst: 5}, true},
+		{"zero requests", Limit{Period: time.Minute}, false},
+		{"negative requests", Limit{Requests: -1, Period: time.Minute}, false},
+		{"zero period", Limit{Requests: 10}, false},
+		{"negative burst", Limit{Requests: 10, Period: time.Minute, Burst: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limit.Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidLimit) {
+				t.Fatalf("Validate() = %v, want ErrInvalidLimit", err)
+			}
+		})
+	}
+}
+
+func TestMemoryTakeRejectsInvalidLimit(t *testing.T) {
+	_, err := NewMemory().Take(context.Background(), "k", Limit{Period: time.Minute})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("Take() error = %v, want ErrInvalidLimit", err)
+	}
+}
+
+func TestMemoryTakeEmptiesBucket(t *testing.T) {
+	store := NewMemory()
+	limit := Limit{Requests: 2, Period: time.Hour}
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(context.Background(), "k", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: Take() = %+v, %v, want allowed", i+1, result, err)
+		}
+	}
+	result, err := store.Take(context.Background(), "k", limit)
+	if err != nil || result.Allowed {
+		t.Fatalf("third request: Take() = %+v, %v, want rejected", result, err)
+	}
+	if result.RetryAfter <= 0 {
+		t.Fatalf("RetryAfter = %v, want positive", result.RetryAfter)
+	}
+	if other, _ := store.Take(context.Background(), "other", limit); !other.Allowed {
+		t.Fatal("buckets of different keys are shared")
+	}
+}
@@ -0,0 +1,99 @@
+package rbac
+
+import "strings"
+
+// Role is stored on model.User and carried in the access token
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission names an action as "resource:action" or "resource:action:scope",
+// where scope is "own" (only the caller's resources) or "any".
+type Permission string
+
+const (
+	PostCreate    Permission = "post:create"
+	PostUpdateOwn Permission = "post:update:own"
+	PostUpdateAny Permission = "post:update:any"
+	PostDeleteOwn Permission = "post:delete:own"
+	PostDeleteAny Permission = "post:delete:any"
+
+	CommentCreate    Permission = "comment:create"
+	CommentUpdateOwn Permission = "comment:update:own"
+	// CommentUpdateAny is granted to no role, so a comment only ever says what
+	// its author wrote; moderators delete comments instead
+	CommentUpdateAny Permission = "comment:update:any"
+	CommentDeleteOwn Permission = "comment:delete:own"
+	CommentDeleteAny Permission = "comment:delete:any"
+
+	ReactionCreate Permission = "reaction:create"
+
+	MediaUpload    Permission = "media:upload"
+	MediaDeleteOwn Permission = "media:delete:own"
+	MediaDeleteAny Permission = "media:delete:any"
+
+	UserManage Permission = "user:manage"
+)
+
+var userPermissions = []Permission{
+	PostCreate, PostUpdateOwn, PostDeleteOwn,
+	CommentCreate, CommentUpdateOwn, CommentDeleteOwn,
+	ReactionCreate,
+	MediaUpload, MediaDeleteOwn,
+}
+
+var moderatorPermissions = append(append([]Permission{}, userPermissions...),
+	CommentDeleteAny, MediaDeleteAny,
+)
+
+var adminPermissions = append(append([]Permission{}, moderatorPermissions...),
+	PostUpdateAny, PostDeleteAny,
+	UserManage,
+)
+
+var rolePermissions = map[Role]map[Permission]bool{
+	RoleUser:      toSet(userPermissions),
+	RoleModerator: toSet(moderatorPermissions),
+	RoleAdmin:     toSet(adminPermissions),
+}
+
+func toSet(perms []Permission) map[Permission]bool {
+	set := make(map[Permission]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+// ParseRole returns the role named by s, treating an empty string as a plain user
+func ParseRole(s string) (Role, bool) {
+	if s == "" {
+		return RoleUser, true
+	}
+	role := Role(s)
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// Can reports whether the role grants the permission
+func (r Role) Can(p Permission) bool {
+	return rolePermissions[r][p]
+}
+
+// Resource returns the resource part of the permission, e.g. "post"
+func (p Permission) Resource() string {
+	return strings.SplitN(string(p), ":", 2)[0]
+}
+
+// Action returns the action part of the permission, e.g. "update"
+func (p Permission) Action() string {
+	parts := strings.Split(string(p), ":")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,26 @@
+package rbac
+
+// TokenScope limits what a personal access token can do on top of its owner's role
+type TokenScope string
+
+const (
+	// ScopeRead allows GET requests
+	ScopeRead TokenScope = "read"
+	// ScopePostsWrite allows creating, editing and deleting posts and media
+	ScopePostsWrite TokenScope = "posts:write"
+	// ScopeCommentsWrite allows creating, editing and deleting comments
+	ScopeCommentsWrite TokenScope = "comments:write"
+)
+
+// TokenScopes lists every scope a token can be given
+var TokenScopes = []TokenScope{ScopeRead, ScopePostsWrite, ScopeCommentsWrite}
+
+// ParseTokenScope returns the scope named by s
+func ParseTokenScope(s string) (TokenScope, bool) {
+	for _, scope := range TokenScopes {
+		if string(scope) == s {
+			return scope, true
+		}
+	}
+	return "", false
+}
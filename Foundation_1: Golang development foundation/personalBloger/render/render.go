@@ -0,0 +1,142 @@
+// Package render turns the Markdown source of posts into sanitized HTML.
+package render
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// WordsPerMinute is the reading speed used for reading time estimates
+const WordsPerMinute = 200
+
+// Heading is one entry of a table of contents. ID is the anchor of the heading
+// in the rendered HTML.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// Document is the rendered form of a Markdown source
+type Document struct {
+	HTML        string    `json:"html"`
+	TOC         []Heading `json:"toc"`
+	WordCount   int       `json:"word_count"`
+	ReadingTime int       `json:"reading_time_minutes"`
+}
+
+// GitHub flavoured Markdown with heading anchors. Raw HTML in the source is
+// dropped by goldmark, and the output is sanitized again as a second line of defence.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+var (
+	policy = newPolicy()
+	// plainText strips every tag, for counting words
+	plainText = bluemonday.StrictPolicy()
+)
+
+// newPolicy allows the elements Markdown produces for user content, plus
+// heading anchors, code languages and task list checkboxes
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Markdown renders source to sanitized HTML and collects its table of
+// contents, word count and reading time
+func Markdown(source string) (*Document, error) {
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, src, doc); err != nil {
+		return nil, err
+	}
+	html := policy.SanitizeBytes(buf.Bytes())
+	words := len(bytes.Fields(plainText.SanitizeBytes(html)))
+
+	return &Document{
+		HTML:        string(html),
+		TOC:         tableOfContents(doc, src),
+		WordCount:   words,
+		ReadingTime: int(math.Ceil(float64(words) / WordsPerMinute)),
+	}, nil
+}
+
+// Summary returns the first maxRunes characters of the rendered text, cut at
+// a word boundary, as plain text
+func (d *Document) Summary(maxRunes int) string {
+	text := html.UnescapeString(plainText.Sanitize(d.HTML))
+	var b strings.Builder
+	runes := 0
+	for _, word := range strings.Fields(text) {
+		n := len([]rune(word))
+		if runes > 0 && runes+1+n > maxRunes {
+			b.WriteString("…")
+			break
+		}
+		if runes > 0 {
+			b.WriteByte(' ')
+			runes++
+		}
+		b.WriteString(word)
+		runes += n
+	}
+	return b.String()
+}
+
+// tableOfContents lists the headings of the document in order
+func tableOfContents(doc ast.Node, src []byte) []Heading {
+	toc := []Heading{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		entry := Heading{Level: heading.Level, Text: nodeText(heading, src)}
+		if id, ok := heading.AttributeString("id"); ok {
+			if b, ok := id.([]byte); ok {
+				entry.ID = string(b)
+			}
+		}
+		toc = append(toc, entry)
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// nodeText concatenates the text below n, leaving out the Markdown markup
+func nodeText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child := child.(type) {
+		case *ast.Text:
+			b.Write(child.Segment.Value(src))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(child.Value)
+		default:
+			b.WriteString(nodeText(child, src))
+		}
+	}
+	return b.String()
+}
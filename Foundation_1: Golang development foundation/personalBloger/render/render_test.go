@@ -0,0 +1,72 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"script block", "<script>alert(1)</script>\n\nhi", "\n<p>hi</p>\n"},
+		{"inline script", "a <script>alert(1)</script> b", "<p>a alert(1) b</p>\n"},
+		{"script in code", "`<script>`", "<p><code>&lt;script&gt;</code></p>\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"mixed case javascript link", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"javascript image", "![x](javascript:alert(1))", "<p><img alt=\"x\"></p>\n"},
+		{"raw html link", `<a href="javascript:alert(1)">x</a>`, "<p>x</p>\n"},
+		{"onerror handler", "<img src=x onerror=alert(1)>", "\n"},
+		{"onmouseover handler", "text <b onmouseover=alert(1)>b</b>", "<p>text b</p>\n"},
+		{"raw html block", "<div onclick=\"alert(1)\">a</div>", "\n"},
+		{"iframe", "<iframe src=\"https://example.com\"></iframe>", "\n"},
+		{"safe link", "[a](https://example.com)", "<p><a href=\"https://example.com\" rel=\"nofollow\">a</a></p>\n"},
+		{"task list", "- [x] done", "<ul>\n<li><input checked=\"\" disabled=\"\" type=\"checkbox\"> done</li>\n</ul>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Markdown(tt.source)
+			if err != nil {
+				t.Fatalf("Markdown() error = %v", err)
+			}
+			if doc.HTML != tt.want {
+				t.Errorf("Markdown(%q).HTML = %q, want %q", tt.source, doc.HTML, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownHeadingIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"repeated heading", "# Intro\n\n# Intro\n\n## Intro", []string{"intro", "intro-1", "intro-2"}},
+		{"heading named like a suffix", "## Intro-1\n\n# Intro\n\n# Intro", []string{"intro-1", "intro", "intro-2"}},
+		{"markup in heading", "# a\"b <c> onclick='x'", []string{"ab-c-onclickx"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Markdown(tt.source)
+			if err != nil {
+				t.Fatalf("Markdown() error = %v", err)
+			}
+			var ids []string
+			for _, heading := range doc.TOC {
+				ids = append(ids, heading.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("TOC ids = %q, want %q", ids, tt.want)
+			}
+			for _, id := range ids {
+				if !strings.Contains(doc.HTML, ` id="`+id+`">`) {
+					t.Errorf("HTML %q has no heading with id %q", doc.HTML, id)
+				}
+			}
+		})
+	}
+}
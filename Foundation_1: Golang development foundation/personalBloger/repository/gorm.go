@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"personalBloger/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GormStore is the Store backed by a GORM database
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a Store that works on db
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Users() UserRepository                 { return gormUsers{s.db} }
+func (s *GormStore) Posts() PostRepository                 { return gormPosts{s.db} }
+func (s *GormStore) Comments() CommentRepository           { return gormComments{s.db} }
+func (s *GormStore) Reactions() ReactionRepository         { return gormReactions{s.db} }
+func (s *GormStore) Sessions() SessionRepository           { return gormSessions{s.db} }
+func (s *GormStore) AccountTokens() AccountTokenRepository { return gormAccountTokens{s.db} }
+func (s *GormStore) LoginFailures() LoginFailureRepository { return gormLoginFailures{s.db} }
+func (s *GormStore) TwoFactor() TwoFactorRepository        { return gormTwoFactor{s.db} }
+func (s *GormStore) Identities() IdentityRepository        { return gormIdentities{s.db} }
+
+// Transaction runs fn in a database transaction. Inside another transaction it
+// uses a savepoint, so units of work can be nested.
+func (s *GormStore) Transaction(ctx context.Context, fn func(Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewGormStore(tx))
+	})
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r gormUsers) find(ctx context.Context, query string, arg interface{}) (*model.User, error) {
+	var user model.User
+	if err := r.db.WithContext(ctx).Where(query, arg).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r gormUsers) FindByID(ctx context.Context, id uint) (*model.User, error) {
+	return r.find(ctx, "id = ?", id)
+}
+
+func (r gormUsers) FindByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.find(ctx, "username = ?", username)
+}
+
+func (r gormUsers) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.find(ctx, "email = ?", email)
+}
+
+func (r gormUsers) Create(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r gormUsers) SetPassword(ctx context.Context, user *model.User, password string) error {
+	return model.SetPassword(r.db.WithContext(ctx), user, password)
+}
+
+func (r gormUsers) MarkEmailVerified(ctx context.Context, userID uint, email string) error {
+	return model.MarkEmailVerified(r.db.WithContext(ctx), userID, email)
+}
+
+func (r gormUsers) AvailableUsername(ctx context.Context, suggested string) (string, error) {
+	return model.AvailableUsername(r.db.WithContext(ctx), suggested)
+}
+
+type gormPosts struct {
+	db *gorm.DB
+}
+
+func (r gormPosts) FindByID(ctx context.Context, id uint) (*model.Post, error) {
+	var post model.Post
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&post).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r gormPosts) FindVisible(ctx context.Context, id, viewerID uint) (*model.Post, error) {
+	var post model.Post
+	err := model.VisiblePosts(r.db.WithContext(ctx), viewerID).
+		Select("posts.*, "+model.CommentCountSQL+" AS comment_count").
+		Preload("Tags").
+		Where("posts.id = ?", id).
+		First(&post).Error
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r gormPosts) Create(ctx context.Context, post *model.Post) error {
+	return r.db.WithContext(ctx).Create(post).Error
+}
+
+func (r gormPosts) Save(ctx context.Context, post *model.Post) error {
+	return r.db.WithContext(ctx).Save(post).Error
+}
+
+func (r gormPosts) Delete(ctx context.Context, post *model.Post) error {
+	return r.db.WithContext(ctx).Delete(post).Error
+}
+
+func (r gormPosts) SetTags(ctx context.Context, post *model.Post, names []string) error {
+	return model.SetPostTags(r.db.WithContext(ctx), post, names)
+}
+
+func (r gormPosts) RecordRevision(ctx context.Context, post *model.Post, editorID uint) error {
+	_, err := model.RecordRevision(r.db.WithContext(ctx), post, editorID, nil)
+	return err
+}
+
+var postSorts = map[string]Sort[model.Post]{
+	"newest":         TimeSort("posts.created_at", true, func(p model.Post) time.Time { return p.CreatedAt }),
+	"oldest":         TimeSort("posts.created_at", false, func(p model.Post) time.Time { return p.CreatedAt }),
+	"most_commented": CountSort(model.CommentCountSQL, true, func(p model.Post) int64 { return p.CommentCount }),
+}
+
+// filter builds the query for the posts that match f
+func (r gormPosts) filter(ctx context.Context, f PostFilter) *gorm.DB {
+	db := r.db.WithContext(ctx)
+	query := model.VisiblePosts(db.Model(&model.Post{}), f.ViewerID)
+	if f.UserID != 0 {
+		query = query.Where("posts.user_id = ?", f.UserID)
+	}
+	if f.FollowedBy != 0 {
+		query = query.Where("posts.user_id IN (?)", model.FolloweeIDs(db, f.FollowedBy))
+	}
+	if f.Tag != "" {
+		query = query.Where("posts.id IN (?)", db.Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.slug = ?", f.Tag))
+	}
+	if f.Status != "" {
+		query = query.Where("posts.status = ?", f.Status)
+	}
+	return whereCreated(query, "posts.created_at", f.From, f.To)
+}
+
+func (r gormPosts) List(ctx context.Context, f PostFilter, page Page) ([]model.Post, *Cursor, error) {
+	sort, ok := postSorts[page.Sort]
+	if !ok {
+		return nil, nil, ErrInvalidSort
+	}
+	query := r.filter(ctx, f).Select("posts.*, " + model.CommentCountSQL + " AS comment_count").Preload("Tags")
+	return Paginate(query, page, sort, "posts.id", func(p model.Post) uint { return p.ID })
+}
+
+func (r gormPosts) Count(ctx context.Context, f PostFilter) (int64, error) {
+	var total int64
+	err := r.filter(ctx, f).Count(&total).Error
+	return total, err
+}
+
+type gormComments struct {
+	db *gorm.DB
+}
+
+func (r gormComments) FindByID(ctx context.Context, id uint) (*model.Comment, error) {
+	var comment model.Comment
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&comment).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+func (r gormComments) Create(ctx context.Context, comment *model.Comment) error {
+	return model.CreateComment(r.db.WithContext(ctx), comment)
+}
+
+func (r gormComments) Edit(ctx context.Context, comment *model.Comment, content string) error {
+	return model.EditComment(r.db.WithContext(ctx), comment, content)
+}
+
+func (r gormComments) Delete(ctx context.Context, comment *model.Comment) error {
+	return model.DeleteComment(r.db.WithContext(ctx), comment)
+}
+
+func (r gormComments) FindReplies(ctx context.Context, postID uint, rootIDs []uint) ([]model.Comment, error) {
+	replies := []model.Comment{}
+	if len(rootIDs) == 0 {
+		return replies, nil
+	}
+	segments := make([]string, 0, len(rootIDs))
+	for _, id := range rootIDs {
+		segments = append(segments, model.PathSegment(id))
+	}
+	// Every reply's path starts with the segment of its top-level comment, and
+	// ordering by path puts parents before their replies
+	err := r.db.WithContext(ctx).
+		Where("post_id = ? AND parent_id IS NOT NULL AND substr(path, 1, ?) IN ?", postID, len(segments[0]), segments).
+		Order("path").
+		Find(&replies).Error
+	return replies, err
+}
+
+var commentSorts = map[string]Sort[model.Comment]{
+	"oldest": TimeSort("comments.created_at", false, func(cm model.Comment) time.Time { return cm.CreatedAt }),
+	"newest": TimeSort("comments.created_at", true, func(cm model.Comment) time.Time { return cm.CreatedAt }),
+	"thread": TextSort("comments.path", false, func(cm model.Comment) string { return cm.Path }),
+}
+
+// filter builds the query for the comments that match f
+func (r gormComments) filter(ctx context.Context, f CommentFilter) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&model.Comment{}).Where("comments.post_id = ?", f.PostID)
+	if f.TopLevel {
+		query = query.Where("comments.parent_id IS NULL")
+	}
+	if f.UserID != 0 {
+		query = query.Where("comments.user_id = ?", f.UserID)
+	}
+	return whereCreated(query, "comments.created_at", f.From, f.To)
+}
+
+func (r gormComments) List(ctx context.Context, f CommentFilter, page Page) ([]model.Comment, *Cursor, error) {
+	sort, ok := commentSorts[page.Sort]
+	if !ok {
+		return nil, nil, ErrInvalidSort
+	}
+	return Paginate(r.filter(ctx, f), page, sort, "comments.id", func(cm model.Comment) uint { return cm.ID })
+}
+
+func (r gormComments) Count(ctx context.Context, f CommentFilter) (int64, error) {
+	var total int64
+	err := r.filter(ctx, f).Count(&total).Error
+	return total, err
+}
+
+type gormReactions struct {
+	db *gorm.DB
+}
+
+func (r gormReactions) Summarize(ctx context.Context, targetType string, targetIDs []uint, viewerID uint) (map[uint]model.ReactionSummary, error) {
+	return model.SummarizeReactions(r.db.WithContext(ctx), targetType, targetIDs, viewerID)
+}
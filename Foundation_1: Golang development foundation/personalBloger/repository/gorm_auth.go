@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"personalBloger/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormSessions struct {
+	db *gorm.DB
+}
+
+func (r gormSessions) Create(ctx context.Context, session *model.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r gormSessions) FindByID(ctx context.Context, id string) (*model.Session, error) {
+	var session model.Session
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r gormSessions) Revoke(ctx context.Context, userID uint, id string) error {
+	return r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r gormSessions) RevokeAll(ctx context.Context, userID uint) error {
+	return model.RevokeUserSessions(r.db.WithContext(ctx), userID)
+}
+
+func (r gormSessions) CreateRefreshToken(ctx context.Context, refresh *model.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(refresh).Error
+}
+
+func (r gormSessions) FindRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var refresh model.RefreshToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&refresh).Error; err != nil {
+		return nil, err
+	}
+	return &refresh, nil
+}
+
+func (r gormSessions) UseRefreshToken(ctx context.Context, refresh *model.RefreshToken) (bool, error) {
+	// Only one of two concurrent requests gets to use the token
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", refresh.ID).
+		Update("used_at", &now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	refresh.UsedAt = &now
+	return true, nil
+}
+
+type gormAccountTokens struct {
+	db *gorm.DB
+}
+
+func (r gormAccountTokens) Save(ctx context.Context, t *model.AccountToken) error {
+	return model.SaveAccountToken(r.db.WithContext(ctx), t)
+}
+
+func (r gormAccountTokens) Use(ctx context.Context, tokenHash, purpose string) (*model.AccountToken, error) {
+	return model.UseAccountToken(r.db.WithContext(ctx), tokenHash, purpose)
+}
+
+type gormLoginFailures struct {
+	db *gorm.DB
+}
+
+func (r gormLoginFailures) Update(ctx context.Context, subjects []string, update func(failures []model.LoginFailure) error) ([]model.LoginFailure, error) {
+	return model.UpdateLoginFailures(r.db.WithContext(ctx), subjects, update)
+}
+
+func (r gormLoginFailures) Clear(ctx context.Context, subjects ...string) error {
+	return model.ClearLoginFailures(r.db.WithContext(ctx), subjects...)
+}
+
+type gormTwoFactor struct {
+	db *gorm.DB
+}
+
+func (r gormTwoFactor) Find(ctx context.Context, userID uint) (*model.TwoFactor, error) {
+	return model.FindTwoFactor(r.db.WithContext(ctx), userID)
+}
+
+func (r gormTwoFactor) Enroll(ctx context.Context, tf *model.TwoFactor) error {
+	return r.db.WithContext(ctx).Save(tf).Error
+}
+
+func (r gormTwoFactor) Enable(ctx context.Context, tf *model.TwoFactor) error {
+	now := time.Now()
+	if err := r.db.WithContext(ctx).Model(tf).Update("enabled_at", &now).Error; err != nil {
+		return err
+	}
+	tf.EnabledAt = &now
+	return nil
+}
+
+func (r gormTwoFactor) Disable(ctx context.Context, userID uint) error {
+	return model.DisableTwoFactor(r.db.WithContext(ctx), userID)
+}
+
+func (r gormTwoFactor) AcceptTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	return model.AcceptTOTPStep(r.db.WithContext(ctx), userID, step)
+}
+
+func (r gormTwoFactor) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	return model.UseRecoveryCode(r.db.WithContext(ctx), userID, codeHash)
+}
+
+func (r gormTwoFactor) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	return model.ReplaceRecoveryCodes(r.db.WithContext(ctx), userID, codeHashes)
+}
+
+func (r gormTwoFactor) CountRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var left int64
+	err := r.db.WithContext(ctx).Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&left).Error
+	return left, err
+}
+
+func (r gormTwoFactor) CreateChallenge(ctx context.Context, challenge *model.TwoFactorChallenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r gormTwoFactor) FindChallenge(ctx context.Context, tokenHash string) (*model.TwoFactorChallenge, error) {
+	var challenge model.TwoFactorChallenge
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&challenge).Error; err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r gormTwoFactor) CountChallengeAttempt(ctx context.Context, challenge *model.TwoFactorChallenge, max int) (bool, error) {
+	return model.CountChallengeAttempt(r.db.WithContext(ctx), challenge.ID, max)
+}
+
+func (r gormTwoFactor) DeleteChallenge(ctx context.Context, challenge *model.TwoFactorChallenge) (bool, error) {
+	result := r.db.WithContext(ctx).Delete(challenge)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormIdentities struct {
+	db *gorm.DB
+}
+
+func (r gormIdentities) Find(ctx context.Context, issuer, subject string) (*model.ExternalIdentity, error) {
+	return model.FindExternalIdentity(r.db.WithContext(ctx), issuer, subject)
+}
+
+func (r gormIdentities) Create(ctx context.Context, identity *model.ExternalIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r gormIdentities) UpdateEmail(ctx context.Context, identity *model.ExternalIdentity, email string) error {
+	return r.db.WithContext(ctx).Model(identity).Update("email", email).Error
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCursor = errors.New("Invalid cursor")
+	// ErrInvalidSort means the listing has no sort of the requested name
+	ErrInvalidSort = errors.New("Invalid sort")
+)
+
+// Page selects one page of a listing. Listings are ordered by a sort and then
+// by id, which makes every position in them unique.
+type Page struct {
+	Limit int
+	// Sort names one of the listing's orders, such as newest
+	Sort string
+	// After is the position the page starts after, nil for the first page
+	After *Cursor
+}
+
+// Cursor is the position after the last row of a page: its value of the sort
+// column and its id
+type Cursor struct {
+	Value string
+	ID    uint
+}
+
+// Sort describes one way rows of type T can be ordered: by Column, then by id
+type Sort[T any] struct {
+	Column string
+	Desc   bool
+	// Value returns the cursor value of a row, Parse turns it back into a query argument
+	Value func(T) string
+	Parse func(string) (interface{}, error)
+}
+
+// TimeSort orders rows by a timestamp column
+func TimeSort[T any](column string, desc bool, value func(T) time.Time) Sort[T] {
+	return Sort[T]{
+		Column: column,
+		Desc:   desc,
+		Value:  func(row T) string { return value(row).Format(time.RFC3339Nano) },
+		Parse: func(s string) (interface{}, error) {
+			return time.Parse(time.RFC3339Nano, s)
+		},
+	}
+}
+
+// CountSort orders rows by a numeric column or expression
+func CountSort[T any](column string, desc bool, value func(T) int64) Sort[T] {
+	return Sort[T]{
+		Column: column,
+		Desc:   desc,
+		Value:  func(row T) string { return strconv.FormatInt(value(row), 10) },
+		Parse: func(s string) (interface{}, error) {
+			return strconv.ParseInt(s, 10, 64)
+		},
+	}
+}
+
+// TextSort orders rows by a string column
+func TextSort[T any](column string, desc bool, value func(T) string) Sort[T] {
+	return Sort[T]{
+		Column: column,
+		Desc:   desc,
+		Value:  value,
+		Parse: func(s string) (interface{}, error) {
+			return s, nil
+		},
+	}
+}
+
+// ScoreSort orders rows by a floating point score such as a search rank
+func ScoreSort[T any](column string, desc bool, value func(T) float64) Sort[T] {
+	return Sort[T]{
+		Column: column,
+		Desc:   desc,
+		Value:  func(row T) string { return strconv.FormatFloat(value(row), 'g', -1, 64) },
+		Parse: func(s string) (interface{}, error) {
+			return strconv.ParseFloat(s, 64)
+		},
+	}
+}
+
+// Paginate runs the query for one page and returns the rows and the cursor of
+// the next page, nil on the last page. idColumn is the qualified primary key,
+// e.g. "posts.id".
+func Paginate[T any](query *gorm.DB, page Page, sort Sort[T], idColumn string, idOf func(T) uint) ([]T, *Cursor, error) {
+	dir, cmp := "ASC", ">"
+	if sort.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if page.After != nil {
+		value, err := sort.Parse(page.After.Value)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		query = query.Where(
+			fmt.Sprintf("((%s %s ?) OR (%s = ? AND %s %s ?))", sort.Column, cmp, sort.Column, idColumn, cmp),
+			value, value, page.After.ID,
+		)
+	}
+
+	var rows []T
+	err := query.
+		Order(fmt.Sprintf("%s %s, %s %s", sort.Column, dir, idColumn, dir)).
+		Limit(page.Limit + 1).
+		Find(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(rows) <= page.Limit {
+		return rows, nil, nil
+	}
+	rows = rows[:page.Limit]
+	last := rows[len(rows)-1]
+	return rows, &Cursor{Value: sort.Value(last), ID: idOf(last)}, nil
+}
+
+// whereCreated bounds a creation time column by from (inclusive) and to (exclusive)
+func whereCreated(query *gorm.DB, column string, from, to *time.Time) *gorm.DB {
+	if from != nil {
+		query = query.Where(column+" >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where(column+" < ?", *to)
+	}
+	return query
+}
@@ -0,0 +1,180 @@
+// Package repository hides how users, posts and comments are stored from the
+// controllers. Controllers receive a Store through their constructors instead
+// of using model.DB, so tests can hand them their own database and multi-step
+// operations can run as one unit of work.
+package repository
+
+import (
+	"context"
+	"personalBloger/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by lookups when nothing matches
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// Store gives access to the repositories
+type Store interface {
+	Users() UserRepository
+	Posts() PostRepository
+	Comments() CommentRepository
+	Reactions() ReactionRepository
+	Sessions() SessionRepository
+	AccountTokens() AccountTokenRepository
+	LoginFailures() LoginFailureRepository
+	TwoFactor() TwoFactorRepository
+	Identities() IdentityRepository
+	// Transaction runs fn as a unit of work: everything done through the Store
+	// passed to fn is committed together, or rolled back when fn returns an error
+	Transaction(ctx context.Context, fn func(Store) error) error
+}
+
+// UserRepository loads and stores user accounts
+type UserRepository interface {
+	FindByID(ctx context.Context, id uint) (*model.User, error)
+	FindByUsername(ctx context.Context, username string) (*model.User, error)
+	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	// Create inserts the user, hashing the plaintext password it carries
+	Create(ctx context.Context, user *model.User) error
+	SetPassword(ctx context.Context, user *model.User, password string) error
+	// MarkEmailVerified verifies the user's address if it is still email
+	MarkEmailVerified(ctx context.Context, userID uint, email string) error
+	// AvailableUsername turns suggested into a username nobody has taken yet
+	AvailableUsername(ctx context.Context, suggested string) (string, error)
+}
+
+// PostRepository loads and stores posts with their tags and revisions
+type PostRepository interface {
+	FindByID(ctx context.Context, id uint) (*model.Post, error)
+	// FindVisible loads a post viewerID may see, with its tags and comment
+	// count. Pass 0 for anonymous viewers.
+	FindVisible(ctx context.Context, id, viewerID uint) (*model.Post, error)
+	Create(ctx context.Context, post *model.Post) error
+	Save(ctx context.Context, post *model.Post) error
+	Delete(ctx context.Context, post *model.Post) error
+	// SetTags replaces the post's tags, creating the ones that do not exist yet
+	SetTags(ctx context.Context, post *model.Post, names []string) error
+	// RecordRevision keeps the post's current title and content as a new revision
+	RecordRevision(ctx context.Context, post *model.Post, editorID uint) error
+	// List returns a page of the posts that match the filter, with their tags
+	// and comment counts, sorted by newest, oldest or most_commented
+	List(ctx context.Context, filter PostFilter, page Page) ([]model.Post, *Cursor, error)
+	// Count returns how many posts match the filter
+	Count(ctx context.Context, filter PostFilter) (int64, error)
+}
+
+// PostFilter selects the posts of a listing. Zero fields do not filter.
+type PostFilter struct {
+	// ViewerID is the caller, 0 for anonymous callers. Posts they may not see
+	// are always left out.
+	ViewerID uint
+	UserID   uint
+	// FollowedBy keeps the posts of the users this user follows
+	FollowedBy uint
+	// Tag is the slug of a tag the posts carry
+	Tag    string
+	Status model.PostStatus
+	// From and To bound the creation time, From inclusive and To exclusive
+	From, To *time.Time
+}
+
+// CommentRepository loads and stores comments and their threads
+type CommentRepository interface {
+	FindByID(ctx context.Context, id uint) (*model.Comment, error)
+	// Create inserts a comment or reply, see model.CreateComment for the errors
+	Create(ctx context.Context, comment *model.Comment) error
+	Edit(ctx context.Context, comment *model.Comment, content string) error
+	// Delete removes the comment or leaves a placeholder, see model.DeleteComment
+	Delete(ctx context.Context, comment *model.Comment) error
+	// FindReplies loads every reply below the top-level comments of the post,
+	// parents before their replies
+	FindReplies(ctx context.Context, postID uint, rootIDs []uint) ([]model.Comment, error)
+	// List returns a page of the comments that match the filter, sorted by
+	// oldest, newest or thread (every comment followed by its replies)
+	List(ctx context.Context, filter CommentFilter, page Page) ([]model.Comment, *Cursor, error)
+	// Count returns how many comments match the filter
+	Count(ctx context.Context, filter CommentFilter) (int64, error)
+}
+
+// CommentFilter selects the comments of a post for a listing. Zero fields
+// other than PostID do not filter.
+type CommentFilter struct {
+	PostID uint
+	UserID uint
+	// TopLevel leaves out replies
+	TopLevel bool
+	// From and To bound the creation time, From inclusive and To exclusive
+	From, To *time.Time
+}
+
+// ReactionRepository reads the reactions to posts and comments
+type ReactionRepository interface {
+	// Summarize returns the reaction summary of each target. viewerID is the
+	// caller, 0 for anonymous callers who have no reactions of their own.
+	Summarize(ctx context.Context, targetType string, targetIDs []uint, viewerID uint) (map[uint]model.ReactionSummary, error)
+}
+
+// SessionRepository stores login sessions and their refresh tokens
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	FindByID(ctx context.Context, id string) (*model.Session, error)
+	// Revoke revokes the user's session with the id
+	Revoke(ctx context.Context, userID uint, id string) error
+	// RevokeAll revokes every active session of the user
+	RevokeAll(ctx context.Context, userID uint) error
+	CreateRefreshToken(ctx context.Context, refresh *model.RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	// UseRefreshToken marks the token as used and returns false if it already was
+	UseRefreshToken(ctx context.Context, refresh *model.RefreshToken) (bool, error)
+}
+
+// AccountTokenRepository stores the tokens sent by email
+type AccountTokenRepository interface {
+	// Save stores the token and drops the user's earlier unused tokens for the
+	// same purpose
+	Save(ctx context.Context, t *model.AccountToken) error
+	// Use consumes a token, see model.UseAccountToken for the errors
+	Use(ctx context.Context, tokenHash, purpose string) (*model.AccountToken, error)
+}
+
+// LoginFailureRepository counts failed logins, see model.LoginFailure
+type LoginFailureRepository interface {
+	// Update passes the records of the subjects to update and saves them, one
+	// update at a time, see model.UpdateLoginFailures
+	Update(ctx context.Context, subjects []string, update func(failures []model.LoginFailure) error) ([]model.LoginFailure, error)
+	Clear(ctx context.Context, subjects ...string) error
+}
+
+// TwoFactorRepository stores TOTP secrets, recovery codes and login challenges
+type TwoFactorRepository interface {
+	Find(ctx context.Context, userID uint) (*model.TwoFactor, error)
+	// Enroll stores a new, not yet enabled secret for the user
+	Enroll(ctx context.Context, tf *model.TwoFactor) error
+	Enable(ctx context.Context, tf *model.TwoFactor) error
+	// Disable removes the user's secret, recovery codes and open challenges
+	Disable(ctx context.Context, userID uint) error
+	// AcceptTOTPStep records the use of a time step, false if it or a later one
+	// was used already
+	AcceptTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+	// UseRecoveryCode consumes an unused recovery code
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error
+	// CountRecoveryCodes returns how many unused recovery codes the user has
+	CountRecoveryCodes(ctx context.Context, userID uint) (int64, error)
+	CreateChallenge(ctx context.Context, challenge *model.TwoFactorChallenge) error
+	FindChallenge(ctx context.Context, tokenHash string) (*model.TwoFactorChallenge, error)
+	// CountChallengeAttempt counts an attempt, false once there were max
+	CountChallengeAttempt(ctx context.Context, challenge *model.TwoFactorChallenge, max int) (bool, error)
+	// DeleteChallenge uses up the challenge, false if it was already gone
+	DeleteChallenge(ctx context.Context, challenge *model.TwoFactorChallenge) (bool, error)
+}
+
+// IdentityRepository stores the links to OpenID Connect provider accounts
+type IdentityRepository interface {
+	Find(ctx context.Context, issuer, subject string) (*model.ExternalIdentity, error)
+	Create(ctx context.Context, identity *model.ExternalIdentity) error
+	// UpdateEmail records the address the provider reported at the last login
+	UpdateEmail(ctx context.Context, identity *model.ExternalIdentity, email string) error
+}
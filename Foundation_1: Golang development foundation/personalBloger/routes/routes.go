@@ -4,49 +4,162 @@ import (
 	"personalBloger/auth"
 	"personalBloger/controller"
 	"personalBloger/middleware"
+	"personalBloger/ratelimit"
+	"personalBloger/rbac"
+	"personalBloger/repository"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitRoutes() *gin.Engine {
+// Rate limits per client and route. Requests are counted against the user when
+// they send a token and against their IP otherwise.
+var (
+	authLimit = ratelimit.PerMinute(10)
+	// Routes that send email are limited harder so they cannot be used to flood inboxes
+	mailLimit = ratelimit.Limit{Requests: 5, Period: 15 * time.Minute}
+	apiLimit  = ratelimit.PerMinute(300)
+	// ipLimit runs before authentication, so requests with invalid or revoked
+	// tokens are limited too. It leaves room for several users behind one address.
+	ipLimit = ratelimit.PerMinute(600)
+)
+
+// InitRoutes builds the router. Controllers that take a repository.Store work on
+// store, and cors says which browser origins may call the API.
+func InitRoutes(store repository.Store, cors middleware.CORSConfig) *gin.Engine {
 	r := gin.New()
 
 	// Add logger middleware globally
 	r.Use(middleware.LoggerMiddleware())
 	// Add recovery middleware to recover from panics
 	r.Use(gin.Recovery())
+	// Global so it also answers preflights, which have no routes of their own
+	r.Use(middleware.CORS(cors))
+
+	authController := auth.NewAuthController(store)
+	postController := controller.NewPostController(store)
+	commentController := controller.NewCommentController(store)
+	adminController := &controller.AdminController{}
+	searchController := &controller.SearchController{}
+	tagController := controller.NewTagController(store)
+	revisionController := &controller.RevisionController{}
+	renderController := &controller.RenderController{}
+	mediaController := &controller.MediaController{}
+	feedController := &controller.FeedController{}
+	reactionController := &controller.ReactionController{}
+	userController := controller.NewUserController(store)
+	notificationController := &controller.NotificationController{}
+	apiTokenController := &controller.APITokenController{}
 
-	authController := &auth.AuthController{}
-	postController := &controller.PostController{}
-	commentController := &controller.CommentController{}
+	r.GET("/.well-known/jwks.json", authController.JWKS)
+	// Feeds live outside the versioned JSON API so their URLs never change
+	r.GET("/feed.xml", feedController.SiteRSS)
+	r.GET("/feed.atom", feedController.SiteAtom)
+	r.GET("/users/:id/feed.xml", feedController.UserRSS)
+	r.GET("/users/:id/feed.atom", feedController.UserAtom)
 	//api
 	api := r.Group("v1")
+	ipRateLimit := middleware.RateLimit("ip", ipLimit, middleware.ByIP)
 	{
 		auth := api.Group("/auth")
+		auth.Use(middleware.RateLimit("auth", authLimit, middleware.ByIP))
 		{
-			auth.POST("/signin", authController.SignIn)
+			mailRateLimit := middleware.RateLimit("mail", mailLimit, middleware.ByIP)
+			auth.POST("/signin", mailRateLimit, authController.SignIn)
 			auth.POST("/login", authController.LogIn)
+			auth.POST("/refresh", authController.Refresh)
+			auth.GET("/verify_email", authController.VerifyEmail)
+			auth.POST("/verify_email", authController.VerifyEmail)
+			auth.POST("/resend_verification", mailRateLimit, authController.ResendVerification)
+			auth.POST("/forgot_password", mailRateLimit, authController.ForgotPassword)
+			auth.POST("/reset_password", authController.ResetPassword)
+			auth.GET("/oidc/login", authController.OIDCLogin)
+			auth.GET("/oidc/callback", authController.OIDCCallback)
+			auth.POST("/logout", middleware.AuthMiddleware(), authController.LogOut)
 
+			twoFactor := auth.Group("/2fa")
+			twoFactor.POST("/verify", authController.VerifyTwoFactor)
+			twoFactor.GET("", middleware.AuthMiddleware(), authController.TwoFactorStatus)
+			twoFactor.POST("/enroll", middleware.AuthMiddleware(), authController.EnrollTwoFactor)
+			twoFactor.POST("/enable", middleware.AuthMiddleware(), authController.EnableTwoFactor)
+			twoFactor.POST("/disable", middleware.AuthMiddleware(), authController.DisableTwoFactor)
+			twoFactor.POST("/recovery_codes", middleware.AuthMiddleware(), authController.RegenerateRecoveryCodes)
 		}
 	}
 
 	{
+		// Personal access tokens are accepted on post, comment and media routes
+		// that match their scopes; everything else needs a login session
 		authenticated := api.Group("")
-		authenticated.Use(middleware.AuthMiddleware())
-		post := authenticated.Group("/post")
-		post.POST("", postController.CreatePost)
-		post.PUT("/:id", postController.UpdatePost)
-		post.DELETE("/:id", postController.DeletePost)
+		authenticated.Use(ipRateLimit, middleware.AuthMiddleware(), middleware.RateLimit("api", apiLimit, middleware.ByUser))
+		post := api.Group("/post", ipRateLimit, middleware.TokenAuth(rbac.ScopePostsWrite), middleware.RateLimit("api", apiLimit, middleware.ByUser))
+		post.POST("", middleware.RequirePermission(rbac.PostCreate), postController.CreatePost)
+		post.PUT("/:id", middleware.RequireOwnership(rbac.PostUpdateOwn, rbac.PostUpdateAny, postController.IsOwner), postController.UpdatePost)
+		post.DELETE("/:id", middleware.RequireOwnership(rbac.PostDeleteOwn, rbac.PostDeleteAny, postController.IsOwner), postController.DeletePost)
+
+		post.PUT("/:id/reactions/:type", middleware.RequirePermission(rbac.ReactionCreate), reactionController.AddPostReaction)
+		post.DELETE("/:id/reactions/:type", middleware.RequirePermission(rbac.ReactionCreate), reactionController.RemovePostReaction)
+
+		// Revision history is available to whoever may edit the post
+		revisions := post.Group("/:id/revisions")
+		revisions.Use(middleware.RequireOwnership(rbac.PostUpdateOwn, rbac.PostUpdateAny, postController.IsOwner))
+		revisions.GET("", revisionController.GetRevisions)
+		revisions.GET("/diff", revisionController.DiffRevisions)
+		revisions.GET("/:number", revisionController.GetRevision)
+		revisions.POST("/:number/restore", revisionController.RestoreRevision)
+
+		comment := api.Group("/comment", ipRateLimit, middleware.TokenAuth(rbac.ScopeCommentsWrite), middleware.RateLimit("api", apiLimit, middleware.ByUser))
+		comment.POST("", middleware.RequirePermission(rbac.CommentCreate), commentController.CreateComment)
+		comment.PUT("/:id", middleware.RequireOwnership(rbac.CommentUpdateOwn, rbac.CommentUpdateAny, commentController.IsOwner), commentController.UpdateComment)
+		comment.DELETE("/:id", middleware.RequireOwnership(rbac.CommentDeleteOwn, rbac.CommentDeleteAny, commentController.IsOwnerOrPostOwner), commentController.DeleteComment)
+		comment.PUT("/:id/reactions/:type", middleware.RequirePermission(rbac.ReactionCreate), reactionController.AddCommentReaction)
+		comment.DELETE("/:id/reactions/:type", middleware.RequirePermission(rbac.ReactionCreate), reactionController.RemoveCommentReaction)
+
+		authenticated.POST("/render/preview", renderController.Preview)
+		authenticated.GET("/feed", userController.GetTimeline)
+		authenticated.PUT("/users/:id/follow", userController.Follow)
+		authenticated.DELETE("/users/:id/follow", userController.Unfollow)
+
+		notifications := authenticated.Group("/notifications")
+		notifications.GET("", notificationController.GetNotifications)
+		notifications.GET("/unread_count", notificationController.GetUnreadCount)
+		notifications.PUT("/read_all", notificationController.MarkAllRead)
+		notifications.PUT("/:id/read", notificationController.MarkRead)
+		notifications.GET("/preferences", notificationController.GetPreferences)
+		notifications.PUT("/preferences", notificationController.UpdatePreferences)
+
+		media := api.Group("/media", ipRateLimit, middleware.TokenAuth(rbac.ScopePostsWrite), middleware.RateLimit("api", apiLimit, middleware.ByUser))
+		media.POST("", middleware.RequirePermission(rbac.MediaUpload), mediaController.Upload)
+		media.DELETE("/:id", middleware.RequireOwnership(rbac.MediaDeleteOwn, rbac.MediaDeleteAny, mediaController.IsOwner), mediaController.DeleteMedia)
 
-		comment := authenticated.Group("/comment")
-		comment.POST("", commentController.CreateComment)
+		authenticated.GET("/tokens", apiTokenController.ListTokens)
+		authenticated.POST("/tokens", apiTokenController.CreateToken)
+		authenticated.DELETE("/tokens/:id", apiTokenController.DeleteToken)
 
+		admin := authenticated.Group("/admin")
+		admin.Use(middleware.RequirePermission(rbac.UserManage))
+		admin.GET("/users", adminController.ListUsers)
+		admin.PUT("/users/:id/role", adminController.UpdateRole)
+		admin.POST("/users/:id/unlock", adminController.UnlockUser)
+		admin.DELETE("/users/:id", adminController.DeleteUser)
 	}
 	{
 		public := api.Group("")
+		// Authors see their own unpublished posts when they send a token
+		public.Use(ipRateLimit, middleware.OptionalAuth(), middleware.RateLimit("api", apiLimit, middleware.ByUser))
 		public.GET("/postlist", postController.GetPostList)
 		public.GET("/post/:id", postController.GetPost)
 		public.GET("/post/:id/comment", commentController.GetComment)
+		public.GET("/post/:id/media", mediaController.GetPostMedia)
+		public.GET("/media/:id", mediaController.GetMedia)
+		public.GET("/media/:id/file", mediaController.GetFile)
+		public.GET("/media/:id/thumbnail", mediaController.GetThumbnail)
+		public.GET("/search", searchController.Search)
+		public.GET("/users/:id", userController.GetProfile)
+		public.GET("/users/:id/followers", userController.GetFollowers)
+		public.GET("/users/:id/following", userController.GetFollowing)
+		public.GET("/tags", tagController.GetTags)
+		public.GET("/tags/:slug/posts", tagController.GetTagPosts)
 	}
 
 	return r
@@ -0,0 +1,34 @@
+// Package storage keeps uploaded files behind a small interface so the backend
+// (local disk or an S3-compatible service) can be chosen at startup.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage stores objects under slash-separated keys such as "2025/11/abc.png"
+type Storage interface {
+	// Put stores size bytes from r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object; it returns ErrNotFound if there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+var defaultStorage Storage = NewLocal("uploads")
+
+// SetDefault replaces the storage used by the application
+func SetDefault(s Storage) {
+	defaultStorage = s
+}
+
+// Default returns the storage used by the application, files under ./uploads
+// unless SetDefault was called
+func Default() Storage {
+	return defaultStorage
+}
@@ -260,6 +260,56 @@ else
 fi
 echo ""
 
+echo -e "${YELLOW}Test 19: Refresh Token${NC}"
+REFRESH_TOKEN=$(echo $LOGIN_RESPONSE | grep -o '"RefreshToken":"[^"]*"' | cut -d'"' -f4)
+REFRESH_RESPONSE=$(curl -s -X POST $BASE_URL/v1/auth/refresh \
+  -H "Content-Type: application/json" \
+  -d "{\"refresh_token\": \"$REFRESH_TOKEN\"}")
+echo "Response: $REFRESH_RESPONSE"
+if echo "$REFRESH_RESPONSE" | grep -q "RefreshToken"; then
+    echo -e "${GREEN}✓ PASSED${NC}"
+else
+    echo -e "${RED}✗ FAILED${NC}"
+fi
+TOKEN=$(echo $REFRESH_RESPONSE | grep -o '"Token":"[^"]*"' | cut -d'"' -f4)
+echo ""
+
+echo -e "${YELLOW}Test 20: Reuse Refresh Token (Should Fail)${NC}"
+REUSE_RESPONSE=$(curl -s -X POST $BASE_URL/v1/auth/refresh \
+  -H "Content-Type: application/json" \
+  -d "{\"refresh_token\": \"$REFRESH_TOKEN\"}")
+echo "Response: $REUSE_RESPONSE"
+if echo "$REUSE_RESPONSE" | grep -q "error"; then
+    echo -e "${GREEN}✓ PASSED - Correctly rejected reused refresh token${NC}"
+else
+    echo -e "${RED}✗ FAILED - Should reject reused refresh token${NC}"
+fi
+echo ""
+
+echo -e "${YELLOW}Test 21: Logout${NC}"
+LOGOUT_RESPONSE=$(curl -s -X POST $BASE_URL/v1/auth/logout \
+  -H "Authorization: Bearer $TOKEN2")
+echo "Response: $LOGOUT_RESPONSE"
+if echo "$LOGOUT_RESPONSE" | grep -q "Logged out"; then
+    echo -e "${GREEN}✓ PASSED${NC}"
+else
+    echo -e "${RED}✗ FAILED${NC}"
+fi
+echo ""
+
+echo -e "${YELLOW}Test 22: Use Token After Logout (Should Fail)${NC}"
+REVOKED_RESPONSE=$(curl -s -X POST $BASE_URL/v1/post \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $TOKEN2" \
+  -d '{"title": "After Logout", "content": "This should fail"}')
+echo "Response: $REVOKED_RESPONSE"
+if echo "$REVOKED_RESPONSE" | grep -q "revoked"; then
+    echo -e "${GREEN}✓ PASSED - Correctly rejected revoked token${NC}"
+else
+    echo -e "${RED}✗ FAILED - Should reject revoked token${NC}"
+fi
+echo ""
+
 echo "=================================="
 echo -e "${GREEN}All API Tests Completed!${NC}"
 echo "=================================="
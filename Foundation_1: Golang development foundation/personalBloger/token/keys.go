@@ -0,0 +1,369 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyStatus controls what a configured key may be used for
+type KeyStatus string
+
+const (
+	// KeyActive signs new tokens. Exactly one key must be active.
+	KeyActive KeyStatus = "active"
+	// KeyVerify only verifies tokens, e.g. the previous key during a rotation
+	KeyVerify KeyStatus = "verify"
+	// KeyRetired is rejected outright and no longer published
+	KeyRetired KeyStatus = "retired"
+)
+
+// KeyConfig describes one signing key
+type KeyConfig struct {
+	ID             string    `json:"kid"`
+	Algorithm      string    `json:"alg"`
+	Status         KeyStatus `json:"status"`
+	Secret         string    `json:"secret,omitempty"`
+	PrivateKeyFile string    `json:"private_key_file,omitempty"`
+	PublicKeyFile  string    `json:"public_key_file,omitempty"`
+}
+
+// KeysConfig is the list of keys loaded from the keys file
+type KeysConfig struct {
+	Keys []KeyConfig `json:"keys"`
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type signingKey struct {
+	id        string
+	status    KeyStatus
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyManager holds the configured keys and picks the right one to sign and verify with
+type KeyManager struct {
+	mu     sync.RWMutex
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+var defaultManager = mustEphemeralManager()
+
+// SetKeyManager replaces the key manager used by GenerateAccessToken and ParseAccessToken
+func SetKeyManager(m *KeyManager) {
+	defaultManager = m
+}
+
+// Keys returns the key manager in use
+func Keys() *KeyManager {
+	return defaultManager
+}
+
+// NewKeyManager builds a key manager from config
+func NewKeyManager(cfg KeysConfig) (*KeyManager, error) {
+	m := &KeyManager{}
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadKeyManager reads a JSON keys file and builds a key manager from it
+func LoadKeyManager(path string) (*KeyManager, error) {
+	cfg, err := LoadKeysConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyManager(cfg)
+}
+
+// LoadKeysConfig reads a JSON keys file
+func LoadKeysConfig(path string) (KeysConfig, error) {
+	var cfg KeysConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse keys file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// EphemeralKeysConfig returns a single random HS256 key. Tokens signed with it
+// do not survive a restart, so it is only meant for local development.
+func EphemeralKeysConfig() KeysConfig {
+	return KeysConfig{Keys: []KeyConfig{{
+		ID:        "ephemeral",
+		Algorithm: "HS256",
+		Status:    KeyActive,
+		Secret:    RandomString(32),
+	}}}
+}
+
+func mustEphemeralManager() *KeyManager {
+	m, err := NewKeyManager(EphemeralKeysConfig())
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Reload swaps in a new set of keys. This is how keys are rotated: add the new key
+// as active, demote the old one to verify, and retire it once its tokens expired.
+func (m *KeyManager) Reload(cfg KeysConfig) error {
+	keys := make(map[string]*signingKey, len(cfg.Keys))
+	var active *signingKey
+	for _, kc := range cfg.Keys {
+		if kc.ID == "" {
+			return errors.New("every key needs a kid")
+		}
+		if _, dup := keys[kc.ID]; dup {
+			return fmt.Errorf("duplicate kid %q", kc.ID)
+		}
+		key, err := loadKey(kc)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", kc.ID, err)
+		}
+		if key.status == KeyActive {
+			if active != nil {
+				return fmt.Errorf("keys %q and %q are both active", active.id, key.id)
+			}
+			if key.signKey == nil {
+				return fmt.Errorf("active key %q has no private key", key.id)
+			}
+			active = key
+		}
+		keys[kc.ID] = key
+	}
+	if active == nil {
+		return errors.New("no active signing key configured")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	m.active = active
+	return nil
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	t := jwt.NewWithClaims(active.method, claims)
+	t.Header["kid"] = active.id
+	return t.SignedString(active.signKey)
+}
+
+// Keyfunc looks up the verification key by kid. Retired keys and tokens whose
+// alg does not match the key are rejected.
+func (m *KeyManager) Keyfunc(t *jwt.Token) (interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key := m.active
+	if kid, ok := t.Header["kid"].(string); ok {
+		key = m.keys[kid]
+	}
+	if key == nil || key.status == KeyRetired {
+		return nil, errors.New("unknown or retired signing key")
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS returns the public part of every asymmetric key that is not retired
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if key.status == KeyRetired {
+			continue
+		}
+		jwk := JWK{KeyID: key.id, Algorithm: key.method.Alg(), Use: "sig"}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = b64(pub.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = pub.Curve.Params().Name
+			jwk.X = b64(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = b64(pub)
+		default:
+			// Shared secrets are never published
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+func loadKey(kc KeyConfig) (*signingKey, error) {
+	switch kc.Status {
+	case KeyActive, KeyVerify, KeyRetired:
+	case "":
+		kc.Status = KeyVerify
+	default:
+		return nil, fmt.Errorf("unknown status %q", kc.Status)
+	}
+	key := &signingKey{id: kc.ID, status: kc.Status}
+
+	switch kc.Algorithm {
+	case "HS256", "HS384", "HS512":
+		if len(kc.Secret) < 32 {
+			return nil, errors.New("HMAC secret must be at least 32 characters")
+		}
+		key.method = jwt.GetSigningMethod(kc.Algorithm)
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+		return key, nil
+	case "RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA":
+		key.method = jwt.GetSigningMethod(kc.Algorithm)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	if kc.PrivateKeyFile != "" {
+		signer, err := readPrivateKey(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key.signKey = signer
+		key.verifyKey = signer.Public()
+	} else if kc.PublicKeyFile != "" {
+		pub, err := readPublicKey(kc.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key.verifyKey = pub
+	} else {
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+	if err := checkKeyType(kc.Algorithm, key.verifyKey); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func checkKeyType(alg string, pub interface{}) error {
+	ok := false
+	switch alg[:2] {
+	case "RS":
+		_, ok = pub.(*rsa.PublicKey)
+	case "ES":
+		var ec *ecdsa.PublicKey
+		if ec, ok = pub.(*ecdsa.PublicKey); ok {
+			want := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}[alg]
+			ok = ec.Curve == want
+		}
+	case "Ed":
+		_, ok = pub.(ed25519.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("key type does not match algorithm %s", alg)
+	}
+	return nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a signing key", path)
+	}
+	return signer, nil
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return pub, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	return block, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
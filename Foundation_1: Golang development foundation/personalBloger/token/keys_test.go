@@ -0,0 +1,200 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// writePEM stores key in a temporary directory as a PKCS#8 private or PKIX
+// public key and returns the path
+func writePEM(t *testing.T, name string, key interface{}) string {
+	t.Helper()
+	var block *pem.Block
+	if signer, ok := key.(crypto.Signer); ok {
+		der, err := x509.MarshalPKCS8PrivateKey(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+	path := filepath.Join(t.TempDir(), name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func generateKey(t *testing.T, alg string) crypto.Signer {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case "RS256", "RS384", "RS512":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("no key generator for %s", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newManager(t *testing.T, keys ...KeyConfig) *KeyManager {
+	t.Helper()
+	m, err := NewKeyManager(KeysConfig{Keys: keys})
+	if err != nil {
+		t.Fatalf("NewKeyManager() error = %v", err)
+	}
+	return m
+}
+
+func sign(t *testing.T, m *KeyManager) string {
+	t.Helper()
+	signed, err := m.Sign(Claims{UserID: 1, Username: "alice"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return signed
+}
+
+// parse verifies signed with m and returns the token
+func parse(signed string, m *KeyManager) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(signed, &Claims{}, m.Keyfunc)
+}
+
+func TestSignAndVerifyEachAlgorithm(t *testing.T) {
+	for _, alg := range []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			active := KeyConfig{ID: "k1", Algorithm: alg, Status: KeyActive, Secret: testSecret}
+			// Other services verify with the public key alone
+			verifier := KeyConfig{ID: "k1", Algorithm: alg, Status: KeyVerify, Secret: testSecret}
+			if alg[:2] != "HS" {
+				key := generateKey(t, alg)
+				active = KeyConfig{ID: "k1", Algorithm: alg, Status: KeyActive, PrivateKeyFile: writePEM(t, "private", key)}
+				verifier = KeyConfig{ID: "k1", Algorithm: alg, Status: KeyVerify, PublicKeyFile: writePEM(t, "public", key.Public())}
+			}
+			m := newManager(t, active)
+			signed := sign(t, m)
+
+			parsed, err := parse(signed, m)
+			if err != nil || !parsed.Valid {
+				t.Fatalf("parse() error = %v, want a valid token", err)
+			}
+			if parsed.Header["alg"] != alg || parsed.Header["kid"] != "k1" {
+				t.Errorf("header = %v, want alg %s and kid k1", parsed.Header, alg)
+			}
+			if claims := parsed.Claims.(*Claims); claims.Username != "alice" {
+				t.Errorf("claims = %+v, want alice", claims)
+			}
+
+			other := newManager(t, verifier, KeyConfig{ID: "k2", Algorithm: "HS256", Status: KeyActive, Secret: testSecret + "2"})
+			if _, err := parse(signed, other); err != nil {
+				t.Errorf("parse() with the verification key error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := KeyConfig{ID: "old", Algorithm: "HS256", Status: KeyActive, Secret: testSecret}
+	m := newManager(t, old)
+	oldToken := sign(t, m)
+
+	// The new key signs, the old one only verifies the tokens it signed
+	old.Status = KeyVerify
+	newKey := KeyConfig{ID: "new", Algorithm: "EdDSA", Status: KeyActive, PrivateKeyFile: writePEM(t, "new", generateKey(t, "EdDSA"))}
+	if err := m.Reload(KeysConfig{Keys: []KeyConfig{old, newKey}}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := parse(oldToken, m); err != nil {
+		t.Errorf("token of the verify key: parse() error = %v", err)
+	}
+	newToken := sign(t, m)
+	if parsed, err := parse(newToken, m); err != nil {
+		t.Errorf("token of the new key: parse() error = %v", err)
+	} else if parsed.Header["kid"] != "new" {
+		t.Errorf("Sign() after the rotation used kid %v, want new", parsed.Header["kid"])
+	}
+
+	old.Status = KeyRetired
+	if err := m.Reload(KeysConfig{Keys: []KeyConfig{old, newKey}}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := parse(oldToken, m); err == nil {
+		t.Error("token of a retired key still verifies")
+	}
+	if _, err := parse(newToken, m); err != nil {
+		t.Errorf("token of the active key: parse() error = %v", err)
+	}
+
+	// A key that does not sign cannot become the active key
+	public := KeyConfig{ID: "public", Algorithm: "EdDSA", Status: KeyActive, PublicKeyFile: writePEM(t, "public", generateKey(t, "EdDSA").Public())}
+	if err := m.Reload(KeysConfig{Keys: []KeyConfig{public}}); err == nil {
+		t.Error("Reload() with a public key as the active key error = nil")
+	}
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	key := generateKey(t, "EdDSA").(ed25519.PrivateKey)
+	m := newManager(t,
+		KeyConfig{ID: "ed", Algorithm: "EdDSA", Status: KeyActive, PrivateKeyFile: writePEM(t, "ed", key)},
+		KeyConfig{ID: "hs", Algorithm: "HS256", Status: KeyVerify, Secret: testSecret},
+	)
+	forge := func(method jwt.SigningMethod, kid string, signKey interface{}) string {
+		t.Helper()
+		forged := jwt.NewWithClaims(method, Claims{UserID: 1, Username: "mallory", Role: "admin"})
+		forged.Header["kid"] = kid
+		signed, err := forged.SignedString(signKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		signed string
+	}{
+		{"unknown kid", forge(jwt.SigningMethodHS256, "missing", []byte(testSecret))},
+		// The public Ed25519 key is no secret, so it must never work as an HMAC key
+		{"HS256 with the Ed25519 kid", forge(jwt.SigningMethodHS256, "ed", []byte(key.Public().(ed25519.PublicKey)))},
+		{"EdDSA with the HS256 kid", forge(SigningMethodEdDSA, "hs", key)},
+		{"HS512 with the HS256 kid", forge(jwt.SigningMethodHS512, "hs", []byte(testSecret))},
+		{"none algorithm", forge(jwt.SigningMethodNone, "ed", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if parsed, err := parse(tt.signed, m); err == nil || parsed.Valid {
+				t.Errorf("parse() error = nil, want the token rejected")
+			}
+		})
+	}
+}
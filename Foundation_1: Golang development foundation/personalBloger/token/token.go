@@ -0,0 +1,83 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"personalBloger/model"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Token lifetimes, set from the configuration at startup
+var (
+	// AccessTokenTTL is how long a signed access token stays valid
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long an opaque refresh token can be exchanged
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Claims is the payload carried by every access token
+type Claims struct {
+	jwt.StandardClaims
+	UserID    uint   `json:"id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+}
+
+// GenerateAccessToken signs a short-lived access token bound to a session
+func GenerateAccessToken(user *model.User, sessionID string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        RandomString(16),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		},
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      string(user.Role),
+		SessionID: sessionID,
+	}
+	return defaultManager.Sign(claims)
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(tokenString, claims, defaultManager.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return claims, nil
+}
+
+// RandomString returns n random bytes encoded as URL-safe base64
+func RandomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to read random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Hash returns the hex SHA-256 digest used to store opaque tokens
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalTokenPrefix starts every personal access token, which tells them
+// apart from JWTs and makes leaked tokens easy to scan for
+const PersonalTokenPrefix = "pbt_"
+
+// NewPersonalToken returns a random personal access token
+func NewPersonalToken() string {
+	return PersonalTokenPrefix + RandomString(32)
+}